@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"regexp"
 	"time"
 
@@ -21,6 +23,7 @@ type ServiceA struct {
 	config shared.Config
 	logger *shared.Logger
 	tracer trace.Tracer
+	meter  *shared.Meter
 	client *http.Client
 }
 
@@ -30,41 +33,54 @@ func main() {
 	}
 
 	config := shared.GetConfig()
-	logLevel := shared.INFO
-	switch config.LogLevel {
-	case "DEBUG":
-		logLevel = shared.DEBUG
-	case "INFO":
-		logLevel = shared.INFO
-	case "WARN":
-		logLevel = shared.WARN
-	case "ERROR":
-		logLevel = shared.ERROR
-	}
-	logger := shared.NewLogger(logLevel, config.LogJSON)
-	tracer, cleanup, err := shared.InitTracer("service-a", config.ZipkinURL)
+	logger, loggerCleanup, err := shared.InitLogger("service-a", config)
+	if err != nil {
+		fmt.Println("Falha ao inicializar logger:", err)
+		os.Exit(1)
+	}
+	defer loggerCleanup()
+	stopReload := shared.ReloadLogLevelOnSIGHUP(logger, func() shared.Config {
+		godotenv.Overload()
+		return shared.GetConfig()
+	})
+	defer stopReload()
+	tracer, cleanup, err := shared.InitTracer("service-a", config)
 	if err != nil {
 		logger.Fatal("Failed to initialize tracer", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 	defer cleanup()
+	meter, meterCleanup, err := shared.InitMeter("service-a", config)
+	if err != nil {
+		logger.Fatal("Failed to initialize meter", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer meterCleanup()
+	retry := config.RetryPolicyFor("service-b")
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Transport: shared.NewRetryTransport(shared.NewBudgetTransport(shared.NewTracingTransport(http.DefaultTransport, tracer)), retry),
+		Timeout:   retry.Timeout,
 	}
 	service := &ServiceA{
 		config: config,
 		logger: logger,
 		tracer: tracer,
+		meter:  meter,
 		client: client,
 	}
-	http.HandleFunc("/cep", service.handleCEPRequest)
-	http.HandleFunc("/health", service.healthCheck)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cep", service.handleCEPRequest)
+	mux.HandleFunc("/health", service.healthCheck)
+	mux.Handle("/metrics", meter.Handler())
+	mux.Handle("/admin/loglevel", shared.LogLevelHandler(logger, config.AdminToken))
 	logger.Info("Service A iniciando", map[string]interface{}{
 		"port":          config.Port,
 		"service_b_url": config.ServiceBURL,
 	})
-	if err := http.ListenAndServe(":"+config.Port, nil); err != nil {
+	handler := shared.DeadlineMiddleware(config.RequestTimeout, shared.TracingMiddleware(tracer, shared.MetricsMiddleware(meter, mux)))
+	if err := http.ListenAndServe(":"+config.Port, handler); err != nil {
 		logger.Fatal("Falha ao iniciar servidor", map[string]interface{}{
 			"error": err.Error(),
 		})
@@ -77,8 +93,7 @@ func (s *ServiceA) healthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *ServiceA) handleCEPRequest(w http.ResponseWriter, r *http.Request) {
-	ctx, span := shared.CreateSpan(r.Context(), s.tracer, "service-a.handleCEPRequest")
-	defer span.End()
+	ctx := r.Context()
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method != http.MethodPost {
 		s.sendErrorResponse(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -86,7 +101,7 @@ func (s *ServiceA) handleCEPRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.logger.Error("Erro ao ler body da requisição", map[string]interface{}{
+		s.logger.ErrorCtx(ctx, "Erro ao ler body da requisição", map[string]interface{}{
 			"error": err.Error(),
 		})
 		s.sendErrorResponse(w, "invalid request body", http.StatusBadRequest)
@@ -94,20 +109,20 @@ func (s *ServiceA) handleCEPRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	var request shared.ZipcodeRequest
 	if err := json.Unmarshal(body, &request); err != nil {
-		s.logger.Error("Erro ao fazer parse do JSON", map[string]interface{}{
+		s.logger.ErrorCtx(ctx, "Erro ao fazer parse do JSON", map[string]interface{}{
 			"error": err.Error(),
 			"body":  string(body),
 		})
 		s.sendErrorResponse(w, "invalid json format", http.StatusBadRequest)
 		return
 	}
-	s.logger.Info("Requisição recebida", map[string]interface{}{
+	s.logger.InfoCtx(ctx, "Requisição recebida", map[string]interface{}{
 		"method": r.Method,
 		"cep":    request.CEP,
 		"ip":     r.RemoteAddr,
 	})
 	if !s.isValidZipcode(request.CEP) {
-		s.logger.Warn("CEP inválido", map[string]interface{}{
+		s.logger.WarnCtx(ctx, "CEP inválido", map[string]interface{}{
 			"cep": request.CEP,
 		})
 		s.sendErrorResponse(w, "invalid zipcode", http.StatusUnprocessableEntity)
@@ -115,7 +130,7 @@ func (s *ServiceA) handleCEPRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	weatherResponse, err := s.callServiceB(ctx, request.CEP)
 	if err != nil {
-		s.logger.Error("Erro ao chamar Service B", map[string]interface{}{
+		s.logger.ErrorCtx(ctx, "Erro ao chamar Service B", map[string]interface{}{
 			"cep":   request.CEP,
 			"error": err.Error(),
 		})
@@ -128,6 +143,14 @@ func (s *ServiceA) handleCEPRequest(w http.ResponseWriter, r *http.Request) {
 			s.sendErrorResponse(w, "invalid zipcode", http.StatusUnprocessableEntity)
 			return
 		}
+		if err.Error() == "location service unavailable" || err.Error() == "weather service unavailable" {
+			s.sendErrorResponse(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err.Error() == "deadline exceeded" {
+			s.sendErrorResponse(w, "deadline exceeded", http.StatusGatewayTimeout)
+			return
+		}
 
 		s.sendErrorResponse(w, "error processing request", http.StatusInternalServerError)
 		return
@@ -141,7 +164,10 @@ func (s *ServiceA) isValidZipcode(zipcode string) bool {
 }
 
 func (s *ServiceA) callServiceB(ctx context.Context, cep string) (*shared.WeatherResponse, error) {
-	ctx, span := shared.CreateSpan(ctx, s.tracer, "service-a.callServiceB")
+	logger := s.logger.Component("service-b")
+	ctx, span := shared.CreateSpan(ctx, s.tracer, "service-a.callServiceB",
+		trace.WithAttributes(shared.AttrCEP.String(cep)),
+	)
 	defer span.End()
 	span.AddEvent("Calling Service B", trace.WithAttributes(
 		attribute.String("cep", cep),
@@ -160,10 +186,11 @@ func (s *ServiceA) callServiceB(ctx context.Context, cep string) (*shared.Weathe
 	start := time.Now()
 	resp, err := s.client.Do(req)
 	duration := time.Since(start)
-	span.AddEvent("Service B response received", trace.WithAttributes(
-		attribute.String("duration", duration.String()),
-	))
+	s.meter.RecordUpstream("service-b", duration, resp, err)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("deadline exceeded")
+		}
 		return nil, fmt.Errorf("failed to make request to service B: %w", err)
 	}
 	defer resp.Body.Close()
@@ -171,7 +198,7 @@ func (s *ServiceA) callServiceB(ctx context.Context, cep string) (*shared.Weathe
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
-	s.logger.Debug("Resposta do Service B", map[string]interface{}{
+	logger.DebugCtx(ctx, "Resposta do Service B", map[string]interface{}{
 		"status_code": resp.StatusCode,
 		"response":    string(respBody),
 		"duration":    duration.String(),
@@ -182,6 +209,16 @@ func (s *ServiceA) callServiceB(ctx context.Context, cep string) (*shared.Weathe
 	if resp.StatusCode == http.StatusUnprocessableEntity {
 		return nil, fmt.Errorf("invalid zipcode")
 	}
+	if resp.StatusCode == http.StatusGatewayTimeout {
+		return nil, fmt.Errorf("deadline exceeded")
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		var errorResponse shared.ErrorResponse
+		if json.Unmarshal(respBody, &errorResponse) == nil && errorResponse.Message == "weather service unavailable" {
+			return nil, fmt.Errorf("weather service unavailable")
+		}
+		return nil, fmt.Errorf("location service unavailable")
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("service B returned status %d: %s", resp.StatusCode, string(respBody))
 	}
@@ -193,6 +230,7 @@ func (s *ServiceA) callServiceB(ctx context.Context, cep string) (*shared.Weathe
 }
 
 func (s *ServiceA) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	s.meter.RecordError(message)
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(shared.ErrorResponse{Message: message})
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(t.Context())
+	otel.SetTextMapPropagator(shared.NewPropagator())
+
+	muxB := http.NewServeMux()
+	muxB.HandleFunc("/weather", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(shared.WeatherResponse{City: "Linhares", TempC: 25, TempF: 77, TempK: 298.15})
+	})
+	serviceB := httptest.NewServer(shared.TracingMiddleware(tp.Tracer("service-b"), muxB))
+	defer serviceB.Close()
+
+	service := &ServiceA{
+		config: shared.Config{ServiceBURL: serviceB.URL},
+		logger: shared.NewLogger(shared.ERROR, false),
+		tracer: tp.Tracer("service-a"),
+		meter:  shared.NewMeter(nil, "service-a"),
+		client: &http.Client{Transport: shared.NewTracingTransport(serviceB.Client().Transport, tp.Tracer("service-a"))},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/cep", strings.NewReader(`{"cep": "29902555"}`))
+	rec := httptest.NewRecorder()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cep", service.handleCEPRequest)
+	shared.TracingMiddleware(service.tracer, mux).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var response shared.WeatherResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.City != "Linhares" || response.TempC != 25 {
+		t.Errorf("response = %+v", response)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.InstrumentationScope().Name+" "+span.Name()] = span
+	}
+	entry, ok := spans["service-a POST /cep"]
+	if !ok {
+		t.Fatal("service-a server span not recorded")
+	}
+	caller, ok := spans["service-a service-a.callServiceB"]
+	if !ok {
+		t.Fatal("service-a.callServiceB span not recorded")
+	}
+	client, ok := spans["service-a "+http.MethodPost]
+	if !ok {
+		t.Fatal("service-a client span not recorded")
+	}
+	server, ok := spans["service-b POST /weather"]
+	if !ok {
+		t.Fatal("service-b server span not recorded")
+	}
+	if caller.Parent().SpanID() != entry.SpanContext().SpanID() {
+		t.Errorf("callServiceB span parent = %s, want %s", caller.Parent().SpanID(), entry.SpanContext().SpanID())
+	}
+	if client.SpanKind() != trace.SpanKindClient {
+		t.Errorf("client span kind = %s, want %s", client.SpanKind(), trace.SpanKindClient)
+	}
+	if client.Parent().SpanID() != caller.SpanContext().SpanID() {
+		t.Errorf("client span parent = %s, want %s", client.Parent().SpanID(), caller.SpanContext().SpanID())
+	}
+	if server.SpanContext().TraceID() != entry.SpanContext().TraceID() {
+		t.Errorf("service-b trace id = %s, want %s", server.SpanContext().TraceID(), entry.SpanContext().TraceID())
+	}
+	if !server.Parent().IsRemote() || server.Parent().SpanID() != client.SpanContext().SpanID() {
+		t.Errorf("service-b span parent = %s (remote %t), want the service-a client span %s",
+			server.Parent().SpanID(), server.Parent().IsRemote(), client.SpanContext().SpanID())
+	}
+}
+
+func TestCallServiceBBudget(t *testing.T) {
+	var budget time.Duration
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, _ = shared.RequestBudget(r)
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(shared.ErrorResponse{Message: "deadline exceeded"})
+	}))
+	defer serviceB.Close()
+	service := &ServiceA{
+		config: shared.Config{ServiceBURL: serviceB.URL},
+		logger: shared.NewLogger(shared.ERROR, false),
+		tracer: sdktrace.NewTracerProvider().Tracer("service-a"),
+		meter:  shared.NewMeter(nil, "service-a"),
+		client: &http.Client{Transport: shared.NewBudgetTransport(serviceB.Client().Transport)},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/cep", strings.NewReader(`{"cep": "29902555"}`))
+	rec := httptest.NewRecorder()
+	shared.DeadlineMiddleware(2*time.Second, http.HandlerFunc(service.handleCEPRequest)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), "deadline exceeded") {
+		t.Errorf("response = %d %s, want 504 deadline exceeded", rec.Code, rec.Body.String())
+	}
+	if budget > 2*time.Second || budget < time.Second {
+		t.Errorf("budget sent to service B = %s, want the remaining request deadline", budget)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+// Cache stores serialized values with a TTL. Backends other than memory are
+// shared between replicas, so values must not depend on process state.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// newCacheFactory returns a function creating the cache of each consumer.
+// The memory backend gives every consumer its own LRU bounded by
+// maxEntries; the Redis backend shares one client between them.
+func newCacheFactory(config shared.Config, tracer trace.Tracer) (func(maxEntries int) Cache, error) {
+	switch config.CacheBackend {
+	case CacheBackendMemory:
+		return func(maxEntries int) Cache { return newLRUCache(maxEntries) }, nil
+	case CacheBackendRedis:
+		redis := NewRedisCache(config.RedisAddr, config.RedisPassword, config.RedisDB, config.RedisKeyPrefix, tracer)
+		return func(int) Cache { return redis }, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", config.CacheBackend)
+	}
+}
+
+// lruCache is an in-memory cache where every entry has its own TTL. Once it
+// holds maxEntries the least recently used entry is evicted.
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+	now        func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newLRUCache(maxEntries int) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+func (c *lruCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *lruCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
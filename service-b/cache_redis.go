@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	redisTimeout   = time.Second
+	redisIdleConns = 16
+)
+
+// RedisCache is a Cache speaking the RESP protocol, so it works with Redis
+// and compatible servers (Valkey, KeyDB, Dragonfly). Connections are kept in
+// a small idle pool and dropped after any error.
+type RedisCache struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	tracer   trace.Tracer
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func NewRedisCache(addr, password string, db int, prefix string, tracer trace.Tracer) *RedisCache {
+	return &RedisCache{
+		addr:     addr,
+		password: password,
+		db:       db,
+		prefix:   prefix,
+		tracer:   tracer,
+		idle:     make(chan *redisConn, redisIdleConns),
+	}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", c.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", c.prefix+key, string(value), "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	return err
+}
+
+func (c *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemRedis,
+		semconv.DBOperation(args[0]),
+		semconv.DBRedisDBIndex(c.db),
+	}
+	if host, port, err := net.SplitHostPort(c.addr); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if port, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	ctx, span := c.tracer.Start(ctx, "redis "+args[0],
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	reply, err := c.roundTrip(ctx, args)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return reply, err
+}
+
+func (c *RedisCache) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.command(ctx, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+	return reply, err
+}
+
+func (c *RedisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: redisTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if c.password != "" {
+		if _, err := conn.command(ctx, "AUTH", c.password); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.command(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *redisConn) command(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(redisTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	c.conn.SetDeadline(deadline)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readRESP(c.reader)
+}
+
+// readRESP reads one RESP2 reply. Bulk strings come back as []byte, nil
+// bulk strings and arrays as nil, and error replies as redisError.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return value[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
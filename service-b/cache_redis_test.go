@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"weather-getter-otel/shared"
+)
+
+// fakeRedis is an in-process stand-in for a Redis server that understands
+// the few RESP commands RedisCache sends.
+type fakeRedis struct {
+	listener    net.Listener
+	password    string
+	mu          sync.Mutex
+	values      map[string]string
+	expires     map[string]time.Time
+	connections int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{listener: listener, password: password, values: map[string]string{}, expires: map[string]time.Time{}}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.connections++
+			server.mu.Unlock()
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeRedis) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	for {
+		request, err := readRESP(reader)
+		if err != nil {
+			return
+		}
+		items, _ := request.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			value, _ := item.([]byte)
+			args[i] = string(value)
+		}
+		if len(args) == 0 {
+			fmt.Fprint(conn, "-ERR empty command\r\n")
+			continue
+		}
+		command := strings.ToUpper(args[0])
+		if !authenticated && command != "AUTH" {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch command {
+		case "AUTH":
+			if len(args) != 2 || args[1] != s.password {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case "SELECT", "PING":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "GET":
+			s.mu.Lock()
+			value, ok := s.values[args[1]]
+			if expires, set := s.expires[args[1]]; ok && set && !time.Now().Before(expires) {
+				delete(s.values, args[1])
+				ok = false
+			}
+			s.mu.Unlock()
+			if !ok {
+				fmt.Fprint(conn, "$-1\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+		case "SET":
+			s.mu.Lock()
+			s.values[args[1]] = args[2]
+			delete(s.expires, args[1])
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			s.mu.Unlock()
+			fmt.Fprint(conn, "+OK\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	cache := NewRedisCache(server.Addr(), "secret", 1, "test:", tracer)
+	ctx := context.Background()
+
+	if _, ok, err := cache.Get(ctx, "missing"); ok || err != nil {
+		t.Fatalf("Get(missing) = %v, %v", ok, err)
+	}
+	if err := cache.Set(ctx, "key", []byte(`{"city":"Linhares"}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	value, ok, err := cache.Get(ctx, "key")
+	if err != nil || !ok || string(value) != `{"city":"Linhares"}` {
+		t.Fatalf("Get(key) = %s, %v, %v", value, ok, err)
+	}
+	if err := cache.Set(ctx, "short", []byte("x"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "short"); ok {
+		t.Error("short should have expired")
+	}
+	if connections := server.Connections(); connections != 1 {
+		t.Errorf("connections = %d, want 1 reused connection", connections)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 5 {
+		t.Fatalf("spans = %d, want 5", len(spans))
+	}
+	attrs := map[string]string{}
+	for _, attr := range spans[0].Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if spans[0].Name() != "redis GET" || attrs["db.system"] != "redis" || attrs["db.operation"] != "GET" {
+		t.Errorf("span = %s %v", spans[0].Name(), attrs)
+	}
+
+	if _, _, err := NewRedisCache(server.Addr(), "wrong", 0, "", tracer).Get(ctx, "key"); err == nil {
+		t.Error("expected authentication error")
+	}
+}
+
+func TestRedisCacheSharedBetweenReplicas(t *testing.T) {
+	server := newFakeRedis(t, "")
+	tracer := noop.NewTracerProvider().Tracer("test")
+	meter := shared.NewMeter(nil, "test")
+	provider := &fakeLocationProvider{name: "viacep"}
+
+	first := NewCachedLocationProvider(provider, NewRedisCache(server.Addr(), "", 0, "test:", tracer), time.Hour, time.Minute, meter, testLogger())
+	second := NewCachedLocationProvider(provider, NewRedisCache(server.Addr(), "", 0, "test:", tracer), time.Hour, time.Minute, meter, testLogger())
+	if _, err := first.Lookup(context.Background(), "29902555"); err != nil {
+		t.Fatal(err)
+	}
+	location, err := second.Lookup(context.Background(), "29902555")
+	if err != nil || location.City != "Linhares" || location.Provider != "viacep" {
+		t.Fatalf("Lookup = %+v, %v", location, err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider calls = %d, want 1", provider.calls)
+	}
+
+	weatherProvider := &fakeWeatherProvider{name: "openmeteo", temp: 25}
+	weather := NewCachedWeatherProvider(weatherProvider, NewRedisCache(server.Addr(), "", 0, "test:", tracer), time.Minute, time.Minute, meter, testLogger())
+	otherWeather := NewCachedWeatherProvider(weatherProvider, NewRedisCache(server.Addr(), "", 0, "test:", tracer), time.Minute, time.Minute, meter, testLogger())
+	weather.Current(context.Background(), location)
+	conditions, err := otherWeather.Current(context.Background(), location)
+	if err != nil || conditions.TempC != 25 || conditions.Provider != "openmeteo" {
+		t.Fatalf("Current = %+v, %v", conditions, err)
+	}
+	if calls := weatherProvider.calls.Load(); calls != 1 {
+		t.Errorf("weather provider calls = %d, want 1", calls)
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	provider := &fakeLocationProvider{name: "viacep"}
+	cached := NewCachedLocationProvider(provider, NewRedisCache(addr, "", 0, "", noop.NewTracerProvider().Tracer("test")), time.Hour, time.Minute, shared.NewMeter(nil, "test"), testLogger())
+	for range 2 {
+		if _, err := cached.Lookup(context.Background(), "29902555"); err != nil {
+			t.Fatalf("Lookup error = %v, want fallback to provider", err)
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider calls = %d, want 2", provider.calls)
+	}
+}
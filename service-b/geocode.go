@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"weather-getter-otel/shared"
+	"weather-getter-otel/shared/geo"
+)
+
+const (
+	geoSourceProvider = "provider"
+	geoSourceIBGECode = "ibge_code"
+	geoSourceIBGEName = "ibge_name"
+)
+
+var ErrMunicipalityNotFound = errors.New("municipality not found")
+
+// enrichLocation resolves the location's municipality in the embedded IBGE
+// dataset, by IBGE code or else by exact city+UF name, filling in the IBGE
+// code, the timezone and any coordinates the CEP provider did not return.
+// Coordinates from the provider are used as they are even when the dataset
+// lacks the municipality. It returns where the coordinates came from, or
+// ErrMunicipalityNotFound when there are none.
+func enrichLocation(location *shared.Location) (string, error) {
+	hasCoordinates := location.Latitude != nil && location.Longitude != nil
+	source := geoSourceIBGECode
+	municipality, ok := geo.ByCode(location.IBGE)
+	if !ok {
+		source = geoSourceIBGEName
+		var err error
+		municipality, err = geo.ByName(location.City, location.State)
+		if err != nil {
+			if hasCoordinates {
+				return geoSourceProvider, nil
+			}
+			return "", fmt.Errorf("%w: %w", ErrMunicipalityNotFound, err)
+		}
+	}
+	location.IBGE = municipality.Code
+	location.Timezone = municipality.Timezone
+	if hasCoordinates {
+		return geoSourceProvider, nil
+	}
+	latitude, longitude := municipality.Latitude, municipality.Longitude
+	location.Latitude = &latitude
+	location.Longitude = &longitude
+	return source, nil
+}
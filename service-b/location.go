@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+var (
+	ErrLocationNotFound    = errors.New("CEP not found")
+	ErrLocationUnavailable = errors.New("location provider unavailable")
+)
+
+type LocationProvider interface {
+	Name() string
+	Lookup(ctx context.Context, cep string) (*shared.Location, error)
+}
+
+func NewLocationProvider(name string, config shared.Config, client *http.Client, logger *shared.Logger, meter *shared.Meter) (LocationProvider, error) {
+	switch name {
+	case "viacep":
+		return NewViaCEPProvider(config.ViaCEPURL, client, logger, meter), nil
+	case "brasilapi":
+		return NewBrasilAPIProvider(config.BrasilAPIURL, client, logger, meter), nil
+	case "opencep":
+		return NewOpenCEPProvider(config.OpenCEPURL, client, logger, meter), nil
+	case "postmon":
+		return NewPostmonProvider(config.PostmonURL, client, logger, meter), nil
+	default:
+		return nil, fmt.Errorf("unknown location provider %q", name)
+	}
+}
+
+// LocationChain tries each provider in order and returns the first answer.
+// A CEP is only reported as not found when at least one provider said so;
+// if every provider failed for other reasons the lookup is unavailable.
+type LocationChain struct {
+	providers []LocationProvider
+	logger    *shared.Logger
+}
+
+func NewLocationChain(logger *shared.Logger, providers ...LocationProvider) *LocationChain {
+	return &LocationChain{providers: providers, logger: logger.Component("location")}
+}
+
+func (c *LocationChain) Name() string {
+	names := make([]string, len(c.providers))
+	for i, provider := range c.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *LocationChain) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	span := trace.SpanFromContext(ctx)
+	notFound := false
+	var errs []error
+	for _, provider := range c.providers {
+		location, err := provider.Lookup(ctx, cep)
+		if err == nil {
+			span.SetAttributes(attribute.String("location.provider", provider.Name()))
+			return location, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrLocationUnavailable, ctx.Err())
+		}
+		span.AddEvent("Location provider failed", trace.WithAttributes(
+			attribute.String("location.provider", provider.Name()),
+			attribute.String("error", err.Error()),
+		))
+		c.logger.WarnCtx(ctx, "Provider de CEP falhou, tentando o próximo", map[string]interface{}{
+			"cep":      cep,
+			"provider": provider.Name(),
+			"error":    err.Error(),
+		})
+		if errors.Is(err, ErrLocationNotFound) {
+			notFound = true
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	if notFound {
+		return nil, ErrLocationNotFound
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w: no location providers configured", ErrLocationUnavailable)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// locationClient maps upstream failures onto ErrLocationNotFound and
+// ErrLocationUnavailable so the chain can tell them apart.
+type locationClient struct {
+	upstreamClient
+}
+
+func newLocationClient(name, baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) locationClient {
+	return locationClient{newUpstreamClient(name, baseURL, client, logger, meter)}
+}
+
+func (c *locationClient) getJSON(ctx context.Context, cep, apiURL string, target interface{}) error {
+	err := c.upstreamClient.getJSON(ctx, apiURL, target)
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		c.logger.WarnCtx(ctx, "CEP não encontrado", map[string]interface{}{
+			"cep": cep,
+		})
+		return ErrLocationNotFound
+	default:
+		return fmt.Errorf("%w: %w", ErrLocationUnavailable, err)
+	}
+}
+
+func (c *locationClient) found(ctx context.Context, location *shared.Location) (*shared.Location, error) {
+	if location.City == "" {
+		c.logger.WarnCtx(ctx, "CEP não encontrado", map[string]interface{}{
+			"cep": location.CEP,
+		})
+		return nil, ErrLocationNotFound
+	}
+	location.Provider = c.name
+	c.logger.InfoCtx(ctx, "CEP encontrado com sucesso", map[string]interface{}{
+		"cep":      location.CEP,
+		"city":     location.City,
+		"state":    location.State,
+		"district": location.Neighborhood,
+		"street":   location.Street,
+	})
+	return location, nil
+}
+
+// CachedLocationProvider keeps the answers of another provider in a Cache.
+// CEPs that were not found are cached too, for negativeTTL, while
+// unavailable providers are never cached so the next request retries.
+// Cache failures are logged and treated as misses.
+type CachedLocationProvider struct {
+	next        LocationProvider
+	cache       Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+	meter       *shared.Meter
+	logger      *shared.Logger
+}
+
+type cachedLocation struct {
+	Location *shared.Location `json:"location,omitempty"`
+	NotFound bool             `json:"not_found,omitempty"`
+}
+
+func NewCachedLocationProvider(next LocationProvider, cache Cache, ttl, negativeTTL time.Duration, meter *shared.Meter, logger *shared.Logger) *CachedLocationProvider {
+	return &CachedLocationProvider{
+		next:        next,
+		cache:       cache,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		meter:       meter,
+		logger:      logger.Component("location"),
+	}
+}
+
+func (c *CachedLocationProvider) Name() string {
+	return c.next.Name()
+}
+
+func (c *CachedLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	span := trace.SpanFromContext(ctx)
+	key := "location:" + cep
+	if entry, ok := c.get(ctx, key); ok {
+		c.meter.RecordCache("location", true)
+		span.SetAttributes(
+			attribute.Bool("location.cache.hit", true),
+			attribute.Bool("location.cache.negative", entry.NotFound),
+		)
+		if entry.NotFound {
+			return nil, ErrLocationNotFound
+		}
+		span.SetAttributes(attribute.String("location.provider", entry.Location.Provider))
+		return entry.Location, nil
+	}
+	c.meter.RecordCache("location", false)
+	span.SetAttributes(attribute.Bool("location.cache.hit", false))
+	location, err := c.next.Lookup(ctx, cep)
+	switch {
+	case err == nil:
+		c.set(ctx, key, cachedLocation{Location: location}, c.ttl)
+	case errors.Is(err, ErrLocationNotFound) && c.negativeTTL > 0:
+		c.set(ctx, key, cachedLocation{NotFound: true}, c.negativeTTL)
+	}
+	return location, err
+}
+
+func (c *CachedLocationProvider) get(ctx context.Context, key string) (cachedLocation, bool) {
+	var entry cachedLocation
+	value, ok, err := c.cache.Get(ctx, key)
+	if err == nil && ok {
+		err = json.Unmarshal(value, &entry)
+	}
+	if err != nil {
+		c.logger.WarnCtx(ctx, "Falha ao ler CEP do cache", map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		})
+		return entry, false
+	}
+	return entry, ok && (entry.NotFound || entry.Location != nil)
+}
+
+func (c *CachedLocationProvider) set(ctx context.Context, key string, entry cachedLocation, ttl time.Duration) {
+	value, err := json.Marshal(entry)
+	if err == nil {
+		err = c.cache.Set(ctx, key, value, ttl)
+	}
+	if err != nil {
+		c.logger.WarnCtx(ctx, "Falha ao gravar CEP no cache", map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		})
+	}
+}
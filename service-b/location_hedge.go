@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+const (
+	HedgeTargetSame = "same"
+	HedgeTargetNext = "next"
+
+	hedgeLatencySamples    = 200
+	hedgeMinLatencySamples = 20
+)
+
+// HedgedLocationProvider sends a second lookup when the primary one has not
+// answered after the given percentile of its recent latencies, and returns
+// whichever answers first; the other one is cancelled. Until enough
+// latencies were observed it waits delay instead. Each attempt gets its own
+// span so both show up in the trace.
+type HedgedLocationProvider struct {
+	primary    LocationProvider
+	hedge      LocationProvider
+	percentile float64
+	delay      time.Duration
+	tracer     trace.Tracer
+	logger     *shared.Logger
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+type hedgeResult struct {
+	attempt  string
+	location *shared.Location
+	err      error
+}
+
+func NewHedgedLocationProvider(primary, hedge LocationProvider, percentile float64, delay time.Duration, tracer trace.Tracer, logger *shared.Logger) *HedgedLocationProvider {
+	return &HedgedLocationProvider{
+		primary:    primary,
+		hedge:      hedge,
+		percentile: percentile,
+		delay:      delay,
+		tracer:     tracer,
+		logger:     logger.Component("location"),
+	}
+}
+
+// newLocationHedge builds what the hedge request queries: the same chain as
+// the primary request, or the chain starting at the next provider.
+func newLocationHedge(target string, logger *shared.Logger, providers []LocationProvider) (LocationProvider, error) {
+	switch {
+	case target == HedgeTargetSame, target == HedgeTargetNext && len(providers) < 2:
+		return NewLocationChain(logger, providers...), nil
+	case target == HedgeTargetNext:
+		return NewLocationChain(logger, append(slices.Clone(providers[1:]), providers[0])...), nil
+	default:
+		return nil, fmt.Errorf("unknown location hedge target %q", target)
+	}
+}
+
+func (h *HedgedLocationProvider) Name() string {
+	return h.primary.Name()
+}
+
+func (h *HedgedLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	span := trace.SpanFromContext(ctx)
+	delay := h.hedgeDelay()
+	span.SetAttributes(attribute.Int64("location.hedge.delay_ms", delay.Milliseconds()))
+	results := make(chan hedgeResult, 2)
+	cancels := map[string]context.CancelFunc{}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	start := time.Now()
+	cancels["primary"] = h.attempt(ctx, "primary", h.primary, cep, results)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	primaryDone := false
+	var first *hedgeResult
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			span.SetAttributes(attribute.Bool("location.hedged", true))
+			h.logger.DebugCtx(ctx, "Provider de CEP lento, enviando requisição de hedge", map[string]interface{}{
+				"cep":      cep,
+				"delay_ms": delay.Milliseconds(),
+			})
+			cancels["hedge"] = h.attempt(ctx, "hedge", h.hedge, cep, results)
+			pending++
+		case result := <-results:
+			pending--
+			if result.attempt == "primary" {
+				primaryDone = true
+				if result.err == nil {
+					h.observe(time.Since(start))
+				}
+				timer.Stop()
+			}
+			if result.err == nil || errors.Is(result.err, ErrLocationNotFound) {
+				span.SetAttributes(attribute.String("location.hedge.winner", result.attempt))
+				if !primaryDone {
+					// The primary is cancelled; it would have taken at least
+					// this long, so keep the slow tail in the samples.
+					h.observe(time.Since(start))
+				}
+				return result.location, result.err
+			}
+			if first == nil {
+				first = &result
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrLocationUnavailable, ctx.Err())
+		}
+	}
+	return nil, first.err
+}
+
+// attempt runs one lookup in the background under its own span and
+// cancellable context, and returns the cancel function.
+func (h *HedgedLocationProvider) attempt(ctx context.Context, attempt string, provider LocationProvider, cep string, results chan<- hedgeResult) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	ctx, span := shared.CreateSpan(ctx, h.tracer, "service-b.location.attempt",
+		trace.WithAttributes(
+			attribute.String("location.hedge.attempt", attempt),
+			attribute.String("location.providers", provider.Name()),
+		),
+	)
+	go func() {
+		defer span.End()
+		location, err := provider.Lookup(ctx, cep)
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			span.SetAttributes(attribute.String("location.hedge.result", "cancelled"))
+		case err != nil && !errors.Is(err, ErrLocationNotFound):
+			span.SetAttributes(attribute.String("location.hedge.result", "error"))
+			span.SetStatus(codes.Error, err.Error())
+		default:
+			span.SetAttributes(attribute.String("location.hedge.result", "ok"))
+		}
+		results <- hedgeResult{attempt: attempt, location: location, err: err}
+	}()
+	return cancel
+}
+
+// hedgeDelay returns the configured percentile of the primary's recent
+// successful latencies, counting a primary that lost to the hedge at the
+// time it was cancelled, or the fixed delay while there are too few of them.
+func (h *HedgedLocationProvider) hedgeDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeMinLatencySamples {
+		return h.delay
+	}
+	sorted := slices.Clone(h.latencies)
+	slices.Sort(sorted)
+	index := min(int(h.percentile*float64(len(sorted))), len(sorted)-1)
+	return sorted[max(index, 0)]
+}
+
+func (h *HedgedLocationProvider) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeLatencySamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeLatencySamples
+}
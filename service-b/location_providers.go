@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"weather-getter-otel/shared"
+)
+
+type ViaCEPProvider struct {
+	locationClient
+}
+
+func NewViaCEPProvider(baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) *ViaCEPProvider {
+	return &ViaCEPProvider{newLocationClient("viacep", baseURL, client, logger, meter)}
+}
+
+func (p *ViaCEPProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	var resp shared.ViaCEPResponse
+	if err := p.getJSON(ctx, cep, fmt.Sprintf("%s/ws/%s/json/", p.baseURL, cep), &resp); err != nil {
+		return nil, err
+	}
+	if resp.Erro {
+		resp.Localidade = ""
+	}
+	return p.found(ctx, &shared.Location{
+		CEP:          cep,
+		City:         resp.Localidade,
+		State:        resp.UF,
+		IBGE:         resp.IBGE,
+		Neighborhood: resp.Bairro,
+		Street:       resp.Logradouro,
+	})
+}
+
+type BrasilAPIProvider struct {
+	locationClient
+}
+
+func NewBrasilAPIProvider(baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) *BrasilAPIProvider {
+	return &BrasilAPIProvider{newLocationClient("brasilapi", baseURL, client, logger, meter)}
+}
+
+func (p *BrasilAPIProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	var resp shared.BrasilAPIResponse
+	if err := p.getJSON(ctx, cep, fmt.Sprintf("%s/api/cep/v2/%s", p.baseURL, cep), &resp); err != nil {
+		return nil, err
+	}
+	location := &shared.Location{
+		CEP:          cep,
+		City:         resp.City,
+		State:        resp.State,
+		Neighborhood: resp.Neighborhood,
+		Street:       resp.Street,
+	}
+	latitude, latErr := strconv.ParseFloat(resp.Location.Coordinates.Latitude, 64)
+	longitude, lonErr := strconv.ParseFloat(resp.Location.Coordinates.Longitude, 64)
+	if latErr == nil && lonErr == nil {
+		location.Latitude = &latitude
+		location.Longitude = &longitude
+	}
+	return p.found(ctx, location)
+}
+
+type OpenCEPProvider struct {
+	locationClient
+}
+
+func NewOpenCEPProvider(baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) *OpenCEPProvider {
+	return &OpenCEPProvider{newLocationClient("opencep", baseURL, client, logger, meter)}
+}
+
+func (p *OpenCEPProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	var resp shared.OpenCEPResponse
+	if err := p.getJSON(ctx, cep, fmt.Sprintf("%s/v1/%s", p.baseURL, cep), &resp); err != nil {
+		return nil, err
+	}
+	return p.found(ctx, &shared.Location{
+		CEP:          cep,
+		City:         resp.Localidade,
+		State:        resp.UF,
+		IBGE:         resp.IBGE,
+		Neighborhood: resp.Bairro,
+		Street:       resp.Logradouro,
+	})
+}
+
+type PostmonProvider struct {
+	locationClient
+}
+
+func NewPostmonProvider(baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) *PostmonProvider {
+	return &PostmonProvider{newLocationClient("postmon", baseURL, client, logger, meter)}
+}
+
+func (p *PostmonProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	var resp shared.PostmonResponse
+	if err := p.getJSON(ctx, cep, fmt.Sprintf("%s/v1/cep/%s", p.baseURL, cep), &resp); err != nil {
+		return nil, err
+	}
+	return p.found(ctx, &shared.Location{
+		CEP:          cep,
+		City:         resp.Cidade,
+		State:        resp.Estado,
+		IBGE:         resp.CidadeInfo.CodigoIBGE,
+		Neighborhood: resp.Bairro,
+		Street:       resp.Logradouro,
+	})
+}
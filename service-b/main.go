@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
+	"os"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,10 +20,26 @@ import (
 )
 
 type ServiceB struct {
-	config shared.Config
-	logger *shared.Logger
-	tracer trace.Tracer
-	client *http.Client
+	config   shared.Config
+	logger   *shared.Logger
+	tracer   trace.Tracer
+	meter    *shared.Meter
+	location LocationProvider
+	weather  WeatherProvider
+	breakers []*shared.CircuitBreaker
+}
+
+// ErrBudgetExhausted is returned when a lookup fails because the request
+// deadline, or the share of it given to the lookup, ran out.
+var ErrBudgetExhausted = errors.New("deadline budget exhausted")
+
+// bulkheadRetryAfter is the Retry-After, in seconds, sent when an upstream's
+// bulkhead rejected the request.
+const bulkheadRetryAfter = "1"
+
+type healthResponse struct {
+	Status          string            `json:"status"`
+	CircuitBreakers map[string]string `json:"circuit_breakers,omitempty"`
 }
 
 func main() {
@@ -29,54 +47,140 @@ func main() {
 		fmt.Println("Aviso: Arquivo .env não encontrado, usando variáveis de ambiente do sistema")
 	}
 	config := shared.GetConfig()
-	logLevel := shared.INFO
-	switch config.LogLevel {
-	case "DEBUG":
-		logLevel = shared.DEBUG
-	case "INFO":
-		logLevel = shared.INFO
-	case "WARN":
-		logLevel = shared.WARN
-	case "ERROR":
-		logLevel = shared.ERROR
+	logger, loggerCleanup, err := shared.InitLogger("service-b", config)
+	if err != nil {
+		fmt.Println("Falha ao inicializar logger:", err)
+		os.Exit(1)
 	}
-	logger := shared.NewLogger(logLevel, config.LogJSON)
-	tracer, cleanup, err := shared.InitTracer("service-b", config.ZipkinURL)
+	defer loggerCleanup()
+	stopReload := shared.ReloadLogLevelOnSIGHUP(logger, func() shared.Config {
+		godotenv.Overload()
+		return shared.GetConfig()
+	})
+	defer stopReload()
+	tracer, cleanup, err := shared.InitTracer("service-b", config)
 	if err != nil {
 		logger.Fatal("Failed to initialize tracer", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 	defer cleanup()
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	meter, meterCleanup, err := shared.InitMeter("service-b", config)
+	if err != nil {
+		logger.Fatal("Failed to initialize meter", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer meterCleanup()
+	var breakers []*shared.CircuitBreaker
+	newClient := func(name string) *http.Client {
+		client := shared.NewRetryingHTTPClient(tracer, config.RetryPolicyFor(name))
+		if policy := config.CircuitBreakerPolicyFor(name); policy.Enabled {
+			breaker := shared.NewCircuitBreaker(name, policy, meter)
+			breakers = append(breakers, breaker)
+			client.Transport = shared.NewCircuitBreakerTransport(client.Transport, breaker)
+		}
+		if policy := config.BulkheadPolicyFor(name); policy.Enabled {
+			client.Transport = shared.NewBulkheadTransport(client.Transport, shared.NewBulkhead(name, policy, meter))
+		}
+		return client
+	}
+	var providers []LocationProvider
+	for _, name := range config.LocationProviders {
+		provider, err := NewLocationProvider(name, config, newClient(name), logger, meter)
+		if err != nil {
+			logger.Fatal("Failed to initialize location provider", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		providers = append(providers, provider)
+	}
+	newCache, err := newCacheFactory(config, tracer)
+	if err != nil {
+		logger.Fatal("Failed to initialize cache", map[string]interface{}{
+			"error": err.Error(),
+		})
 	}
+	var location LocationProvider = NewLocationChain(logger, providers...)
+	if config.LocationHedge {
+		hedge, err := newLocationHedge(config.LocationHedgeTarget, logger, providers)
+		if err != nil {
+			logger.Fatal("Failed to initialize location hedging", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		location = NewHedgedLocationProvider(location, hedge, config.LocationHedgePercentile, config.LocationHedgeDelay, tracer, logger)
+	}
+	if config.CEPCacheTTL > 0 {
+		location = NewCachedLocationProvider(location, newCache(config.CEPCacheMaxEntries), config.CEPCacheTTL, config.CEPCacheNegativeTTL, meter, logger)
+	}
+	location = NewCoalescingLocationProvider(location, tracer)
+	var weatherProviders []WeatherProvider
+	for _, name := range config.WeatherProviders {
+		provider, err := NewWeatherProvider(name, config, newClient(name), logger, meter)
+		if err != nil {
+			logger.Fatal("Failed to initialize weather provider", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		weatherProviders = append(weatherProviders, provider)
+	}
+	composite, err := NewCompositeWeatherProvider(config.WeatherMode, config.WeatherProviderTimeout, logger, weatherProviders...)
+	if err != nil {
+		logger.Fatal("Failed to initialize weather provider", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	var weather WeatherProvider = composite
+	if config.WeatherCacheTTL > 0 {
+		weather = NewCachedWeatherProvider(weather, newCache(config.WeatherCacheMaxEntries), config.WeatherCacheTTL, config.WeatherCacheStaleTTL, meter, logger)
+	}
+	weather = NewCoalescingWeatherProvider(weather, tracer)
 	service := &ServiceB{
-		config: config,
-		logger: logger,
-		tracer: tracer,
-		client: client,
+		config:   config,
+		logger:   logger,
+		tracer:   tracer,
+		meter:    meter,
+		location: location,
+		weather:  weather,
+		breakers: breakers,
 	}
-	http.HandleFunc("/weather", service.handleWeatherRequest)
-	http.HandleFunc("/health", service.healthCheck)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/weather", service.handleWeatherRequest)
+	mux.HandleFunc("/health", service.healthCheck)
+	mux.Handle("/metrics", meter.Handler())
+	mux.Handle("/admin/loglevel", shared.LogLevelHandler(logger, config.AdminToken))
 	logger.Info("Service B iniciando", map[string]interface{}{
 		"port": config.Port,
 	})
-	if err := http.ListenAndServe(":"+config.Port, nil); err != nil {
+	handler := shared.DeadlineMiddleware(config.RequestTimeout, shared.TracingMiddleware(tracer, shared.MetricsMiddleware(meter, mux)))
+	if err := http.ListenAndServe(":"+config.Port, handler); err != nil {
 		logger.Fatal("Falha ao iniciar servidor", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 }
 
+// healthCheck always answers 200 while the service is up; open circuit
+// breakers only mark it as degraded, listing the state of each upstream.
 func (s *ServiceB) healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	response := healthResponse{Status: "ok"}
+	if len(s.breakers) > 0 {
+		response.CircuitBreakers = map[string]string{}
+	}
+	for _, breaker := range s.breakers {
+		state := breaker.State()
+		response.CircuitBreakers[breaker.Name()] = state
+		if state != shared.CircuitClosed {
+			response.Status = "degraded"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func (s *ServiceB) handleWeatherRequest(w http.ResponseWriter, r *http.Request) {
-	ctx, span := shared.CreateSpan(r.Context(), s.tracer, "service-b.handleWeatherRequest")
-	defer span.End()
+	ctx := r.Context()
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method != http.MethodPost {
 		s.sendErrorResponse(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -84,7 +188,7 @@ func (s *ServiceB) handleWeatherRequest(w http.ResponseWriter, r *http.Request)
 	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.logger.Error("Erro ao ler body da requisição", map[string]interface{}{
+		s.logger.ErrorCtx(ctx, "Erro ao ler body da requisição", map[string]interface{}{
 			"error": err.Error(),
 		})
 		s.sendErrorResponse(w, "invalid request body", http.StatusBadRequest)
@@ -92,20 +196,20 @@ func (s *ServiceB) handleWeatherRequest(w http.ResponseWriter, r *http.Request)
 	}
 	var request shared.ZipcodeRequest
 	if err := json.Unmarshal(body, &request); err != nil {
-		s.logger.Error("Erro ao fazer parse do JSON", map[string]interface{}{
+		s.logger.ErrorCtx(ctx, "Erro ao fazer parse do JSON", map[string]interface{}{
 			"error": err.Error(),
 			"body":  string(body),
 		})
 		s.sendErrorResponse(w, "invalid json format", http.StatusBadRequest)
 		return
 	}
-	s.logger.Info("Requisição recebida", map[string]interface{}{
+	s.logger.InfoCtx(ctx, "Requisição recebida", map[string]interface{}{
 		"method": r.Method,
 		"cep":    request.CEP,
 		"ip":     r.RemoteAddr,
 	})
 	if !s.isValidZipcode(request.CEP) {
-		s.logger.Warn("CEP inválido", map[string]interface{}{
+		s.logger.WarnCtx(ctx, "CEP inválido", map[string]interface{}{
 			"cep": request.CEP,
 		})
 		s.sendErrorResponse(w, "invalid zipcode", http.StatusUnprocessableEntity)
@@ -113,34 +217,77 @@ func (s *ServiceB) handleWeatherRequest(w http.ResponseWriter, r *http.Request)
 	}
 	location, err := s.getLocationFromCEP(ctx, request.CEP)
 	if err != nil {
-		s.logger.Error("Erro ao obter localização", map[string]interface{}{
+		s.logger.ErrorCtx(ctx, "Erro ao obter localização", map[string]interface{}{
 			"cep":   request.CEP,
 			"error": err.Error(),
 		})
-		s.sendErrorResponse(w, "can not find zipcode", http.StatusNotFound)
+		if errors.Is(err, ErrBudgetExhausted) {
+			s.sendErrorResponse(w, "deadline exceeded", http.StatusGatewayTimeout)
+			return
+		}
+		if errors.Is(err, ErrLocationNotFound) {
+			s.sendErrorResponse(w, "can not find zipcode", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrMunicipalityNotFound) {
+			s.sendErrorResponse(w, "can not locate municipality", http.StatusInternalServerError)
+			return
+		}
+		if errors.Is(err, shared.ErrBulkheadFull) {
+			w.Header().Set("Retry-After", bulkheadRetryAfter)
+		}
+		s.sendErrorResponse(w, "location service unavailable", http.StatusServiceUnavailable)
 		return
 	}
-	s.logger.Info("Localização encontrada", map[string]interface{}{
-		"cep":   request.CEP,
-		"city":  location.Localidade,
-		"state": location.UF,
+	s.logger.InfoCtx(ctx, "Localização encontrada", map[string]interface{}{
+		"cep":      request.CEP,
+		"city":     location.City,
+		"state":    location.State,
+		"provider": location.Provider,
 	})
-	weather, err := s.getWeatherFromLocation(ctx, location.Localidade)
+	weather, err := s.getWeatherFromLocation(ctx, location)
 	if err != nil {
-		s.logger.Error("Erro ao obter clima", map[string]interface{}{
-			"city":  location.Localidade,
+		s.logger.ErrorCtx(ctx, "Erro ao obter clima", map[string]interface{}{
+			"city":  location.City,
 			"error": err.Error(),
 		})
+		if errors.Is(err, ErrBudgetExhausted) {
+			s.sendErrorResponse(w, "deadline exceeded", http.StatusGatewayTimeout)
+			return
+		}
+		if errors.Is(err, shared.ErrBulkheadFull) {
+			w.Header().Set("Retry-After", bulkheadRetryAfter)
+		}
+		if errors.Is(err, shared.ErrCircuitOpen) || errors.Is(err, shared.ErrBulkheadFull) {
+			s.sendErrorResponse(w, "weather service unavailable", http.StatusServiceUnavailable)
+			return
+		}
 		s.sendErrorResponse(w, "error getting weather information", http.StatusInternalServerError)
 		return
 	}
+	var observationAge *int64
+	if !weather.ObservedAt.IsZero() {
+		age := int64(max(time.Since(weather.ObservedAt), 0).Seconds())
+		observationAge = &age
+		w.Header().Set("X-Observation-Age", strconv.FormatInt(age, 10))
+	}
 	response := shared.WeatherResponse{
-		City:  location.Localidade,
-		TempC: weather.Current.TempC,
-		TempF: weather.Current.TempF,
-		TempK: weather.Current.TempC + 273.15,
+		City:  location.City,
+		TempC: weather.TempC,
+		TempF: weather.TempF(),
+		TempK: weather.TempK(),
+
+		TempSpreadC:      weather.SpreadC,
+		ObservationAge:   observationAge,
+		State:            location.State,
+		IBGE:             location.IBGE,
+		Timezone:         location.Timezone,
+		Latitude:         location.Latitude,
+		Longitude:        location.Longitude,
+		LocationProvider: location.Provider,
+		WeatherProvider:  weather.Provider,
 	}
-	s.logger.Info("Enviando resposta", map[string]interface{}{
+	s.logger.InfoCtx(ctx, "Enviando resposta", map[string]interface{}{
 		"cep":    request.CEP,
 		"city":   response.City,
 		"temp_c": response.TempC,
@@ -155,131 +302,76 @@ func (s *ServiceB) isValidZipcode(zipcode string) bool {
 	return matched
 }
 
-func (s *ServiceB) getLocationFromCEP(ctx context.Context, cep string) (*shared.ViaCEPResponse, error) {
-	ctx, span := shared.CreateSpan(ctx, s.tracer, "service-b.getLocationFromCEP")
+func (s *ServiceB) getLocationFromCEP(ctx context.Context, cep string) (*shared.Location, error) {
+	ctx, span := shared.CreateSpan(ctx, s.tracer, "service-b.getLocationFromCEP",
+		trace.WithAttributes(shared.AttrCEP.String(cep)),
+	)
 	defer span.End()
-	span.AddEvent("Calling ViaCEP API", trace.WithAttributes(
+	span.AddEvent("Calling location provider", trace.WithAttributes(
 		attribute.String("cep", cep),
+		attribute.String("location.providers", s.location.Name()),
 	))
-	apiURL := fmt.Sprintf("https://viacep.com.br/ws/%s/json/", cep)
-	s.logger.Debug("Consultando ViaCEP", map[string]interface{}{
-		"cep":      cep,
-		"endpoint": apiURL,
-	})
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if deadline, ok := ctx.Deadline(); ok && s.config.LocationBudgetRatio > 0 {
+		budget := time.Duration(float64(time.Until(deadline)) * min(s.config.LocationBudgetRatio, 1))
+		span.SetAttributes(attribute.Int64("deadline.budget_ms", budget.Milliseconds()))
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
 	}
-	start := time.Now()
-	resp, err := s.client.Do(req)
-	duration := time.Since(start)
-	span.AddEvent("ViaCEP response received", trace.WithAttributes(
-		attribute.String("duration", duration.String()),
-	))
+	location, err := s.location.Lookup(ctx, cep)
 	if err != nil {
-		s.logger.Error("Erro ao consultar ViaCEP", map[string]interface{}{
-			"cep":   cep,
-			"error": err.Error(),
-		})
-		return nil, fmt.Errorf("error contacting ViaCEP: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		s.logger.Error("ViaCEP retornou status inválido", map[string]interface{}{
-			"cep":         cep,
-			"status_code": resp.StatusCode,
-		})
-		return nil, fmt.Errorf("ViaCEP returned status code %d", resp.StatusCode)
+		if budgetExhausted(ctx) {
+			return nil, fmt.Errorf("%w: %w", ErrBudgetExhausted, err)
+		}
+		return nil, err
 	}
-	var viaCEPResp shared.ViaCEPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&viaCEPResp); err != nil {
-		s.logger.Error("Erro ao decodificar resposta do ViaCEP", map[string]interface{}{
-			"cep":   cep,
-			"error": err.Error(),
-		})
-		return nil, fmt.Errorf("error decoding ViaCEP response: %w", err)
+	source, err := enrichLocation(location)
+	if err != nil {
+		return nil, err
 	}
-	if viaCEPResp.Erro || viaCEPResp.Localidade == "" {
-		s.logger.Warn("CEP não encontrado", map[string]interface{}{
-			"cep": cep,
-		})
-		return nil, fmt.Errorf("CEP not found")
+	span.SetAttributes(
+		attribute.String("geo.source", source),
+		attribute.Float64("geo.lat", *location.Latitude),
+		attribute.Float64("geo.lon", *location.Longitude),
+	)
+	return location, nil
+}
+
+// budgetExhausted reports whether the request's own deadline has passed; a
+// shorter inner timeout, such as WEATHER_PROVIDER_TIMEOUT, does not count.
+// The clock is checked too because an inner context with the same deadline
+// may fire a moment before ctx's own timer.
+func budgetExhausted(ctx context.Context) bool {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
 	}
-	s.logger.Info("CEP encontrado com sucesso", map[string]interface{}{
-		"cep":      cep,
-		"city":     viaCEPResp.Localidade,
-		"state":    viaCEPResp.UF,
-		"district": viaCEPResp.Bairro,
-		"street":   viaCEPResp.Logradouro,
-	})
-	return &viaCEPResp, nil
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
 }
 
-func (s *ServiceB) getWeatherFromLocation(ctx context.Context, city string) (*shared.WeatherAPIResponse, error) {
+func (s *ServiceB) getWeatherFromLocation(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
 	ctx, span := shared.CreateSpan(ctx, s.tracer, "service-b.getWeatherFromLocation")
 	defer span.End()
-	span.AddEvent("Calling WeatherAPI", trace.WithAttributes(
-		attribute.String("city", city),
+	span.AddEvent("Calling weather provider", trace.WithAttributes(
+		attribute.String("city", location.City),
+		attribute.String("weather.providers", s.weather.Name()),
 	))
-	apiKey := s.config.WeatherAPIKey
-	s.logger.Debug("Verificando chave de API", map[string]interface{}{
-		"key_length": len(apiKey),
-	})
-	if apiKey == "" {
-		return nil, fmt.Errorf("WEATHER_API_KEY environment variable not set")
+	if deadline, ok := ctx.Deadline(); ok {
+		span.SetAttributes(attribute.Int64("deadline.budget_ms", time.Until(deadline).Milliseconds()))
 	}
-	query := fmt.Sprintf("%s, Brazil", city)
-	query = url.QueryEscape(query)
-	apiURL := fmt.Sprintf("https://api.weatherapi.com/v1/current.json?key=%s&q=%s&aqi=no", apiKey, query)
-	s.logger.Debug("Fazendo requisição para WeatherAPI", map[string]interface{}{
-		"city":         city,
-		"encoded_city": query,
-	})
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	conditions, err := s.weather.Current(ctx, location)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	start := time.Now()
-	resp, err := s.client.Do(req)
-	duration := time.Since(start)
-	span.AddEvent("WeatherAPI response received", trace.WithAttributes(
-		attribute.String("duration", duration.String()),
-	))
-	if err != nil {
-		s.logger.Error("Falha na requisição HTTP", map[string]interface{}{
-			"error": err.Error(),
-			"city":  city,
-		})
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		responseBody := string(body)
-		s.logger.Error("Resposta de erro da WeatherAPI", map[string]interface{}{
-			"status_code": resp.StatusCode,
-			"response":    responseBody,
-			"city":        city,
-		})
-		return nil, fmt.Errorf("weather API returned status code %d: %s", resp.StatusCode, responseBody)
+		if budgetExhausted(ctx) {
+			return nil, fmt.Errorf("%w: %w", ErrBudgetExhausted, err)
+		}
+		return nil, err
 	}
-	var weatherResp shared.WeatherAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&weatherResp); err != nil {
-		s.logger.Error("Erro ao decodificar resposta", map[string]interface{}{
-			"error": err.Error(),
-		})
-		return nil, fmt.Errorf("error decoding response: %w", err)
-	}
-	s.logger.Info("Dados de clima obtidos com sucesso", map[string]interface{}{
-		"city":    city,
-		"temp_c":  weatherResp.Current.TempC,
-		"temp_f":  weatherResp.Current.TempF,
-		"country": weatherResp.Location.Country,
-	})
-	return &weatherResp, nil
+	span.SetAttributes(attribute.String("weather.provider", conditions.Provider))
+	return conditions, nil
 }
 
 func (s *ServiceB) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	s.meter.RecordError(message)
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(shared.ErrorResponse{Message: message})
 }
@@ -0,0 +1,1146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"weather-getter-otel/shared"
+)
+
+func testLogger() *shared.Logger {
+	return shared.NewLoggerWithOptions(shared.LoggerOptions{Level: shared.ERROR, Writer: &bytes.Buffer{}})
+}
+
+func TestViaCEPProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ws/29902555/json/":
+			w.Write([]byte(`{"cep":"29902-555","logradouro":"Rua Teste","bairro":"Centro","localidade":"Linhares","uf":"ES","ibge":"3203205"}`))
+		case "/ws/99999999/json/":
+			w.Write([]byte(`{"erro": true}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	provider := NewViaCEPProvider(server.URL+"/", server.Client(), testLogger(), shared.NewMeter(nil, "test"))
+
+	location, err := provider.Lookup(context.Background(), "29902555")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := shared.Location{CEP: "29902555", City: "Linhares", State: "ES", IBGE: "3203205", Neighborhood: "Centro", Street: "Rua Teste", Provider: "viacep"}
+	if *location != expected {
+		t.Errorf("location = %+v, want %+v", *location, expected)
+	}
+	if _, err := provider.Lookup(context.Background(), "99999999"); !errors.Is(err, ErrLocationNotFound) {
+		t.Errorf("Lookup(99999999) error = %v, want ErrLocationNotFound", err)
+	}
+	if _, err := provider.Lookup(context.Background(), "01001000"); !errors.Is(err, ErrLocationUnavailable) {
+		t.Errorf("Lookup(01001000) error = %v, want ErrLocationUnavailable", err)
+	}
+}
+
+func TestLocationProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/cep/v2/29902555":
+			w.Write([]byte(`{"cep":"29902555","state":"ES","city":"Linhares","neighborhood":"Centro","street":"Rua Teste","location":{"type":"Point","coordinates":{"longitude":"-40.07","latitude":"-19.39"}}}`))
+		case "/v1/29902555":
+			w.Write([]byte(`{"cep":"29902-555","logradouro":"Rua Teste","bairro":"Centro","localidade":"Linhares","uf":"ES","ibge":"3203205"}`))
+		case "/v1/cep/29902555":
+			w.Write([]byte(`{"cep":"29902555","logradouro":"Rua Teste","bairro":"Centro","cidade":"Linhares","estado":"ES","cidade_info":{"codigo_ibge":"3203205"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	config := shared.Config{BrasilAPIURL: server.URL, OpenCEPURL: server.URL, PostmonURL: server.URL}
+
+	for _, name := range []string{"brasilapi", "opencep", "postmon"} {
+		provider, err := NewLocationProvider(name, config, server.Client(), testLogger(), shared.NewMeter(nil, "test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		location, err := provider.Lookup(context.Background(), "29902555")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if location.City != "Linhares" || location.State != "ES" || location.Provider != name {
+			t.Errorf("%s: location = %+v", name, *location)
+		}
+		if _, err := provider.Lookup(context.Background(), "99999999"); !errors.Is(err, ErrLocationNotFound) {
+			t.Errorf("%s: Lookup(99999999) error = %v, want ErrLocationNotFound", name, err)
+		}
+	}
+	if _, err := NewLocationProvider("correios", config, server.Client(), testLogger(), shared.NewMeter(nil, "test")); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+type fakeLocationProvider struct {
+	name      string
+	city      string
+	latitude  *float64
+	longitude *float64
+	err       error
+	calls     int
+}
+
+func (p *fakeLocationProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	city := p.city
+	if city == "" {
+		city = "Linhares"
+	}
+	return &shared.Location{CEP: cep, City: city, State: "ES", Latitude: p.latitude, Longitude: p.longitude, Provider: p.name}, nil
+}
+
+func TestLocationChain(t *testing.T) {
+	unavailable := fmt.Errorf("%w: status 503", ErrLocationUnavailable)
+	tests := []struct {
+		name      string
+		providers []*fakeLocationProvider
+		provider  string
+		err       error
+	}{
+		{
+			name:      "falls back when unavailable",
+			providers: []*fakeLocationProvider{{name: "viacep", err: unavailable}, {name: "brasilapi"}},
+			provider:  "brasilapi",
+		},
+		{
+			name:      "falls back when not found",
+			providers: []*fakeLocationProvider{{name: "viacep", err: ErrLocationNotFound}, {name: "brasilapi"}},
+			provider:  "brasilapi",
+		},
+		{
+			name:      "not found wins over unavailable",
+			providers: []*fakeLocationProvider{{name: "viacep", err: unavailable}, {name: "brasilapi", err: ErrLocationNotFound}},
+			err:       ErrLocationNotFound,
+		},
+		{
+			name:      "all unavailable",
+			providers: []*fakeLocationProvider{{name: "viacep", err: unavailable}, {name: "brasilapi", err: unavailable}},
+			err:       ErrLocationUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			ctx, span := tracer.Start(context.Background(), "lookup")
+			var providers []LocationProvider
+			for _, provider := range tt.providers {
+				providers = append(providers, provider)
+			}
+			location, err := NewLocationChain(testLogger(), providers...).Lookup(ctx, "29902555")
+			span.End()
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				if tt.err == ErrLocationUnavailable && errors.Is(err, ErrLocationNotFound) {
+					t.Fatalf("error = %v, should not be ErrLocationNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if location.Provider != tt.provider {
+				t.Errorf("provider = %q, want %q", location.Provider, tt.provider)
+			}
+			attrs := recorder.Ended()[0].Attributes()
+			found := false
+			for _, attr := range attrs {
+				if attr.Key == "location.provider" && attr.Value.AsString() == tt.provider {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("span attributes %v missing location.provider=%s", attrs, tt.provider)
+			}
+		})
+	}
+}
+
+func TestOpenMeteoProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/forecast" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("latitude") != "-19.39" || r.URL.Query().Get("longitude") != "-40.07" {
+			t.Errorf("unexpected coordinates %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"latitude":-19.39,"longitude":-40.07,"current":{"time":1700000000,"temperature_2m":25.5,"relative_humidity_2m":80,"wind_speed_10m":12.3}}`))
+	}))
+	defer server.Close()
+	provider := NewOpenMeteoProvider(server.URL, server.Client(), testLogger(), shared.NewMeter(nil, "test"))
+
+	latitude, longitude := -19.39, -40.07
+	conditions, err := provider.Current(context.Background(), &shared.Location{City: "Linhares", State: "ES", Latitude: &latitude, Longitude: &longitude})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conditions.TempC != 25.5 || conditions.Humidity != 80 || conditions.Provider != "openmeteo" || conditions.ObservedAt.Unix() != 1700000000 {
+		t.Errorf("conditions = %+v", *conditions)
+	}
+	if _, err := provider.Current(context.Background(), &shared.Location{City: "Linhares", State: "ES"}); !errors.Is(err, ErrWeatherUnavailable) {
+		t.Errorf("error = %v, want ErrWeatherUnavailable without coordinates", err)
+	}
+}
+
+func TestWeatherAPIProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/current.json" || r.URL.Query().Get("key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if q := r.URL.Query().Get("q"); q != "-19.390000,-40.070000" {
+			t.Errorf("q = %s, want the location coordinates", q)
+		}
+		w.Write([]byte(`{"location":{"name":"Linhares","country":"Brazil"},"current":{"last_updated_epoch":1700000000,"temp_c":25,"temp_f":77,"humidity":70,"wind_kph":10}}`))
+	}))
+	defer server.Close()
+
+	latitude, longitude := -19.39, -40.07
+	location := &shared.Location{City: "Linhares", State: "ES", Latitude: &latitude, Longitude: &longitude}
+	conditions, err := NewWeatherAPIProvider(server.URL, "secret", server.Client(), testLogger(), shared.NewMeter(nil, "test")).
+		Current(context.Background(), location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conditions.TempC != 25 || conditions.TempF() != 77 || conditions.Provider != "weatherapi" {
+		t.Errorf("conditions = %+v", *conditions)
+	}
+	for _, key := range []string{"", "wrong"} {
+		_, err := NewWeatherAPIProvider(server.URL, key, server.Client(), testLogger(), shared.NewMeter(nil, "test")).
+			Current(context.Background(), location)
+		if !errors.Is(err, ErrWeatherUnavailable) {
+			t.Errorf("key %q: error = %v, want ErrWeatherUnavailable", key, err)
+		}
+	}
+	_, err = NewWeatherAPIProvider(server.URL, "secret", server.Client(), testLogger(), shared.NewMeter(nil, "test")).
+		Current(context.Background(), &shared.Location{City: "Linhares", State: "ES"})
+	if !errors.Is(err, ErrWeatherUnavailable) {
+		t.Errorf("error = %v, want ErrWeatherUnavailable without coordinates", err)
+	}
+}
+
+type fakeWeatherProvider struct {
+	name  string
+	temp  float64
+	err   error
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (p *fakeWeatherProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeWeatherProvider) Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	p.calls.Add(1)
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &shared.WeatherConditions{TempC: p.temp, Provider: p.name}, nil
+}
+
+func TestCompositeWeatherProvider(t *testing.T) {
+	unavailable := fmt.Errorf("%w: status 500", ErrWeatherUnavailable)
+	tests := []struct {
+		name      string
+		mode      string
+		providers []WeatherProvider
+		temp      float64
+		spread    *float64
+		provider  string
+		attrs     map[string]string
+		err       error
+	}{
+		{
+			name:      "failover skips errors and timeouts",
+			mode:      WeatherModeFailover,
+			providers: []WeatherProvider{&fakeWeatherProvider{name: "a", err: unavailable}, &fakeWeatherProvider{name: "b", delay: time.Second}, &fakeWeatherProvider{name: "c", temp: 21}},
+			temp:      21,
+			provider:  "c",
+			attrs:     map[string]string{"weather.a.result": "error", "weather.b.result": "timeout", "weather.c.result": "ok"},
+		},
+		{
+			name:      "consensus returns median and spread",
+			mode:      WeatherModeConsensus,
+			providers: []WeatherProvider{&fakeWeatherProvider{name: "a", temp: 30}, &fakeWeatherProvider{name: "b", temp: 20}, &fakeWeatherProvider{name: "c", temp: 22}, &fakeWeatherProvider{name: "d", err: unavailable}},
+			temp:      22,
+			spread:    func() *float64 { v := 10.0; return &v }(),
+			provider:  "a,b,c",
+			attrs:     map[string]string{"weather.a.result": "ok", "weather.d.result": "error"},
+		},
+		{
+			name:      "consensus fails when every provider fails",
+			mode:      WeatherModeConsensus,
+			providers: []WeatherProvider{&fakeWeatherProvider{name: "a", err: unavailable}, &fakeWeatherProvider{name: "b", delay: time.Second}},
+			err:       ErrWeatherUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			composite, err := NewCompositeWeatherProvider(tt.mode, 50*time.Millisecond, testLogger(), tt.providers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			ctx, span := tracer.Start(context.Background(), "weather")
+			conditions, err := composite.Current(ctx, &shared.Location{City: "Linhares"})
+			span.End()
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conditions.TempC != tt.temp || conditions.Provider != tt.provider {
+				t.Errorf("conditions = %+v, want temp %v from %s", *conditions, tt.temp, tt.provider)
+			}
+			if (tt.spread == nil) != (conditions.SpreadC == nil) || (tt.spread != nil && *tt.spread != *conditions.SpreadC) {
+				t.Errorf("spread = %v, want %v", conditions.SpreadC, tt.spread)
+			}
+			attrs := map[string]string{}
+			for _, attr := range recorder.Ended()[0].Attributes() {
+				attrs[string(attr.Key)] = attr.Value.Emit()
+			}
+			for key, value := range tt.attrs {
+				if attrs[key] != value {
+					t.Errorf("attribute %s = %q, want %q", key, attrs[key], value)
+				}
+			}
+			if _, ok := attrs["weather.a.latency_ms"]; !ok {
+				t.Error("missing weather.a.latency_ms attribute")
+			}
+		})
+	}
+	if _, err := NewCompositeWeatherProvider("majority", time.Second, testLogger(), &fakeWeatherProvider{name: "a"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestEnrichLocation(t *testing.T) {
+	latitude, longitude := -19.4, -40.1
+	tests := []struct {
+		name     string
+		location shared.Location
+		source   string
+		ibge     string
+		timezone string
+		err      error
+	}{
+		{"provider coordinates", shared.Location{City: "Linhares", State: "ES", Latitude: &latitude, Longitude: &longitude}, geoSourceProvider, "3203205", "America/Sao_Paulo", nil},
+		{"ibge code", shared.Location{City: "Linhares", State: "ES", IBGE: "3203205"}, geoSourceIBGECode, "3203205", "America/Sao_Paulo", nil},
+		{"unknown ibge code", shared.Location{City: "Vitória", State: "ES", IBGE: "0000000"}, geoSourceIBGEName, "3205309", "America/Sao_Paulo", nil},
+		{"city and state", shared.Location{City: "Vitoria", State: "ES"}, geoSourceIBGEName, "3205309", "America/Sao_Paulo", nil},
+		{"misspelled city", shared.Location{City: "Vila Vleha", State: "ES"}, "", "", "", ErrMunicipalityNotFound},
+		{"wrong state", shared.Location{City: "Vitória", State: "SP"}, "", "", "", ErrMunicipalityNotFound},
+		{"provider coordinates without municipality", shared.Location{City: "Cidade Inexistente", State: "ES", IBGE: "3299999", Latitude: &latitude, Longitude: &longitude}, geoSourceProvider, "3299999", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := tt.location
+			source, err := enrichLocation(&location)
+			if !errors.Is(err, tt.err) || source != tt.source {
+				t.Fatalf("enrichLocation() = %q, %v; want %q, %v", source, err, tt.source, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if location.Latitude == nil || location.Longitude == nil {
+				t.Error("coordinates not set")
+			}
+			if location.IBGE != tt.ibge {
+				t.Errorf("ibge = %q, want %q", location.IBGE, tt.ibge)
+			}
+			if location.Timezone != tt.timezone {
+				t.Errorf("timezone = %q, want %q", location.Timezone, tt.timezone)
+			}
+		})
+	}
+}
+
+func TestHandleWeatherRequest(t *testing.T) {
+	weather, err := NewCompositeWeatherProvider(WeatherModeFailover, time.Second, testLogger(), &fakeWeatherProvider{name: "openmeteo", temp: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &ServiceB{
+		logger:   testLogger(),
+		tracer:   sdktrace.NewTracerProvider().Tracer("test"),
+		meter:    shared.NewMeter(nil, "test"),
+		location: NewLocationChain(testLogger(), &fakeLocationProvider{name: "viacep"}),
+		weather:  weather,
+	}
+	rec := httptest.NewRecorder()
+	service.handleWeatherRequest(rec, httptest.NewRequest(http.MethodPost, "/weather", bytes.NewBufferString(`{"cep":"29902555"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var response shared.WeatherResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.City != "Linhares" || response.TempC != 25 || response.TempK != 298.15 {
+		t.Errorf("response = %+v", response)
+	}
+	if response.LocationProvider != "viacep" || response.WeatherProvider != "openmeteo" {
+		t.Errorf("providers = %q, %q", response.LocationProvider, response.WeatherProvider)
+	}
+	if response.State != "ES" || response.IBGE != "3203205" || response.Timezone != "America/Sao_Paulo" {
+		t.Errorf("enrichment = %q, %q, %q", response.State, response.IBGE, response.Timezone)
+	}
+	if response.Latitude == nil || response.Longitude == nil || *response.Latitude != -19.3946 {
+		t.Errorf("coordinates = %v, %v", response.Latitude, response.Longitude)
+	}
+}
+
+func TestHandleWeatherRequestUnknownMunicipality(t *testing.T) {
+	latitude, longitude := -19.4, -40.1
+	tests := []struct {
+		name     string
+		provider *fakeLocationProvider
+		status   int
+		calls    int32
+	}{
+		{"provider coordinates", &fakeLocationProvider{name: "brasilapi", city: "Cidade Inexistente", latitude: &latitude, longitude: &longitude}, http.StatusOK, 1},
+		{"no coordinates", &fakeLocationProvider{name: "viacep", city: "Linharez"}, http.StatusInternalServerError, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weather := &fakeWeatherProvider{name: "openmeteo", temp: 25}
+			service := &ServiceB{
+				logger:   testLogger(),
+				tracer:   sdktrace.NewTracerProvider().Tracer("test"),
+				meter:    shared.NewMeter(nil, "test"),
+				location: NewLocationChain(testLogger(), tt.provider),
+				weather:  weather,
+			}
+			rec := httptest.NewRecorder()
+			service.handleWeatherRequest(rec, httptest.NewRequest(http.MethodPost, "/weather", bytes.NewBufferString(`{"cep":"14801000"}`)))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if weather.calls.Load() != tt.calls {
+				t.Errorf("weather calls = %d, want %d", weather.calls.Load(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := newLRUCache(2)
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	cache.Set(ctx, "a", []byte("1"), time.Minute)
+	cache.Set(ctx, "b", []byte("2"), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatal("a missing")
+	}
+	cache.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	if value, ok, _ := cache.Get(ctx, "a"); !ok || string(value) != "1" {
+		t.Errorf("Get(a) = %s, %v", value, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "c"); ok {
+		t.Error("c should have expired")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", cache.Len())
+	}
+}
+
+func TestCachedLocationProvider(t *testing.T) {
+	found := &fakeLocationProvider{name: "viacep"}
+	meter := shared.NewMeter(nil, "test")
+	cached := NewCachedLocationProvider(found, newLRUCache(10), time.Hour, time.Minute, meter, testLogger())
+	for range 3 {
+		location, err := cached.Lookup(context.Background(), "29902555")
+		if err != nil || location.City != "Linhares" {
+			t.Fatalf("Lookup = %+v, %v", location, err)
+		}
+		location.City = "mutated"
+	}
+	if found.calls != 1 {
+		t.Errorf("provider calls = %d, want 1", found.calls)
+	}
+
+	notFound := &fakeLocationProvider{name: "viacep", err: ErrLocationNotFound}
+	cached = NewCachedLocationProvider(notFound, newLRUCache(10), time.Hour, time.Minute, meter, testLogger())
+	for range 2 {
+		if _, err := cached.Lookup(context.Background(), "99999999"); !errors.Is(err, ErrLocationNotFound) {
+			t.Fatalf("error = %v, want ErrLocationNotFound", err)
+		}
+	}
+	if notFound.calls != 1 {
+		t.Errorf("not found provider calls = %d, want 1", notFound.calls)
+	}
+
+	unavailable := &fakeLocationProvider{name: "viacep", err: ErrLocationUnavailable}
+	cached = NewCachedLocationProvider(unavailable, newLRUCache(10), time.Hour, time.Minute, meter, testLogger())
+	for range 2 {
+		cached.Lookup(context.Background(), "01001000")
+	}
+	if unavailable.calls != 2 {
+		t.Errorf("unavailable provider calls = %d, want 2", unavailable.calls)
+	}
+
+	metrics := meter.Prometheus()
+	for _, line := range []string{
+		`cache_requests_total{cache="location",result="hit"} 3`,
+		`cache_requests_total{cache="location",result="miss"} 4`,
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("metrics missing %q:\n%s", line, metrics)
+		}
+	}
+}
+
+func TestWeatherCacheKey(t *testing.T) {
+	latitude, longitude := -19.39461, -40.06432
+	tests := []struct {
+		location shared.Location
+		key      string
+	}{
+		{shared.Location{IBGE: "3203205", City: "Linhares", Latitude: &latitude, Longitude: &longitude}, "weather:ibge:3203205"},
+		{shared.Location{City: "Linhares", Latitude: &latitude, Longitude: &longitude}, "weather:coord:-19.39,-40.06"},
+		{shared.Location{City: " Linhares ", State: "es"}, "weather:city:linhares/ES"},
+	}
+	for _, tt := range tests {
+		if key := weatherCacheKey(&tt.location); key != tt.key {
+			t.Errorf("weatherCacheKey(%+v) = %q, want %q", tt.location, key, tt.key)
+		}
+	}
+}
+
+func TestCachedWeatherProvider(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	provider := &fakeWeatherProvider{name: "openmeteo", temp: 20}
+	cache := newLRUCache(10)
+	cache.now = clock
+	cached := NewCachedWeatherProvider(provider, cache, 5*time.Minute, 10*time.Minute, shared.NewMeter(nil, "test"), testLogger())
+	cached.now = clock
+	location := &shared.Location{IBGE: "3203205", City: "Linhares"}
+
+	if _, err := cached.Current(context.Background(), location); err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Minute)
+	cached.Current(context.Background(), &shared.Location{IBGE: "3203205", City: "Outro CEP"})
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Fatalf("provider calls = %d, want 1 while fresh", calls)
+	}
+
+	advance(5 * time.Minute)
+	conditions, err := cached.Current(context.Background(), location)
+	if err != nil || conditions.TempC != 20 {
+		t.Fatalf("stale Current = %+v, %v", conditions, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for provider.calls.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if calls := provider.calls.Load(); calls != 2 {
+		t.Fatalf("provider calls = %d, want background refresh", calls)
+	}
+
+	refreshing := func() bool {
+		cached.mu.Lock()
+		defer cached.mu.Unlock()
+		return len(cached.refreshing) > 0
+	}
+	for refreshing() {
+		time.Sleep(time.Millisecond)
+	}
+	advance(16 * time.Minute)
+	provider.err = ErrWeatherUnavailable
+	if _, err := cached.Current(context.Background(), location); !errors.Is(err, ErrWeatherUnavailable) {
+		t.Errorf("error = %v, want ErrWeatherUnavailable after stale window", err)
+	}
+}
+
+type blockingLocationProvider struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (p *blockingLocationProvider) Name() string {
+	return "blocking"
+}
+
+func (p *blockingLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	p.calls.Add(1)
+	<-p.release
+	return &shared.Location{CEP: cep, City: "Linhares", State: "ES", Provider: "blocking"}, nil
+}
+
+func TestCoalescingLocationProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	provider := &blockingLocationProvider{release: make(chan struct{})}
+	coalescing := NewCoalescingLocationProvider(provider, tracer)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	locations := make([]*shared.Location, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := tracer.Start(context.Background(), "request")
+			defer span.End()
+			locations[i], errs[i] = coalescing.Lookup(ctx, "29902555")
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		coalescing.group.mu.Lock()
+		call := coalescing.group.calls["29902555"]
+		waiters := 0
+		if call != nil {
+			waiters = call.waiters
+		}
+		coalescing.group.mu.Unlock()
+		if waiters == callers-1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(provider.release)
+	wg.Wait()
+
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("provider calls = %d, want 1", calls)
+	}
+	for i := range callers {
+		if errs[i] != nil || locations[i].City != "Linhares" {
+			t.Fatalf("caller %d: %+v, %v", i, locations[i], errs[i])
+		}
+	}
+	locations[0].City = "mutated"
+	if locations[1].City != "Linhares" {
+		t.Error("callers share the same location value")
+	}
+
+	var leader sdktrace.ReadOnlySpan
+	var waiters []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "service-b.location.fetch":
+			leader = span
+		case "service-b.location.wait":
+			waiters = append(waiters, span)
+		}
+	}
+	if leader == nil || len(waiters) != callers-1 {
+		t.Fatalf("leader = %v, waiters = %d", leader != nil, len(waiters))
+	}
+	for _, waiter := range waiters {
+		links := waiter.Links()
+		if len(links) != 1 || links[0].SpanContext.SpanID() != leader.SpanContext().SpanID() {
+			t.Errorf("waiter links = %v, want link to %s", links, leader.SpanContext().SpanID())
+		}
+	}
+}
+
+func TestCoalescingWaiterCancellation(t *testing.T) {
+	provider := &blockingLocationProvider{release: make(chan struct{})}
+	coalescing := NewCoalescingLocationProvider(provider, noop.NewTracerProvider().Tracer("test"))
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := coalescing.Lookup(context.Background(), "29902555")
+		leaderDone <- err
+	}()
+	for provider.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := coalescing.Lookup(ctx, "29902555"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiter error = %v, want context.DeadlineExceeded", err)
+	}
+	close(provider.release)
+	if err := <-leaderDone; err != nil {
+		t.Errorf("leader error = %v", err)
+	}
+}
+
+type cancellableLocationProvider struct {
+	calls     atomic.Int32
+	release   chan struct{}
+	cancelled chan struct{}
+}
+
+func (p *cancellableLocationProvider) Name() string {
+	return "cancellable"
+}
+
+func (p *cancellableLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	p.calls.Add(1)
+	select {
+	case <-p.release:
+		return &shared.Location{CEP: cep, City: "Linhares", State: "ES", Provider: "cancellable"}, nil
+	case <-ctx.Done():
+		close(p.cancelled)
+		return nil, ctx.Err()
+	}
+}
+
+func TestCoalescingLeaderCancellation(t *testing.T) {
+	provider := &cancellableLocationProvider{release: make(chan struct{}), cancelled: make(chan struct{})}
+	coalescing := NewCoalescingLocationProvider(provider, noop.NewTracerProvider().Tracer("test"))
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := coalescing.Lookup(leaderCtx, "29902555")
+		leaderDone <- err
+	}()
+	for provider.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiterCtx, cancelWaiter := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelWaiter()
+	waiterDone := make(chan error, 1)
+	go func() {
+		_, err := coalescing.Lookup(waiterCtx, "29902555")
+		waiterDone <- err
+	}()
+	for {
+		coalescing.group.mu.Lock()
+		pending := coalescing.group.calls["29902555"].pending
+		coalescing.group.mu.Unlock()
+		if pending == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader error = %v, want context.Canceled", err)
+	}
+	select {
+	case <-provider.cancelled:
+		t.Fatal("lookup should keep running while a waiter remains")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelWaiter()
+	if err := <-waiterDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("waiter error = %v, want context.Canceled", err)
+	}
+	select {
+	case <-provider.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("lookup should be cancelled once no caller is waiting")
+	}
+
+	close(provider.release)
+	if _, err := coalescing.Lookup(context.Background(), "29902555"); err != nil {
+		t.Fatalf("new lookup after cancellation: %v", err)
+	}
+	if provider.calls.Load() != 2 {
+		t.Errorf("provider calls = %d, want a fresh lookup after the abandoned one", provider.calls.Load())
+	}
+}
+
+// deadlineLocationProvider runs its first lookup until the context is done
+// and answers every later one at once.
+type deadlineLocationProvider struct {
+	calls atomic.Int32
+}
+
+func (p *deadlineLocationProvider) Name() string {
+	return "deadline"
+}
+
+func (p *deadlineLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	if p.calls.Add(1) == 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &shared.Location{CEP: cep, City: "Linhares", State: "ES", Provider: "deadline"}, nil
+}
+
+func TestCoalescingLeaderDeadline(t *testing.T) {
+	provider := &deadlineLocationProvider{}
+	coalescing := NewCoalescingLocationProvider(provider, noop.NewTracerProvider().Tracer("test"))
+
+	leaderCtx, cancelLeader := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelLeader()
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := coalescing.Lookup(leaderCtx, "29902555")
+		leaderDone <- err
+	}()
+	for provider.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiterCtx, cancelWaiter := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelWaiter()
+	waiterDone := make(chan error, 1)
+	go func() {
+		_, err := coalescing.Lookup(waiterCtx, "29902555")
+		waiterDone <- err
+	}()
+	for {
+		coalescing.group.mu.Lock()
+		call := coalescing.group.calls["29902555"]
+		waiters := 0
+		if call != nil {
+			waiters = call.waiters
+		}
+		coalescing.group.mu.Unlock()
+		if waiters == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := <-leaderDone; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("leader error = %v, want context.DeadlineExceeded", err)
+	}
+	if err := <-waiterDone; err != nil {
+		t.Errorf("waiter error = %v, a waiter with budget left should not fail on the leader's deadline", err)
+	}
+	if calls := provider.calls.Load(); calls != 2 {
+		t.Errorf("provider calls = %d, want a fresh lookup for the waiter", calls)
+	}
+}
+
+func TestHealthCheckCircuitBreakers(t *testing.T) {
+	meter := shared.NewMeter(nil, "test")
+	policy := shared.CircuitBreakerPolicy{Enabled: true, FailureRatio: 0.5, MinRequests: 1, Window: time.Minute, Cooldown: time.Minute}
+	viacep := shared.NewCircuitBreaker("viacep", policy, meter)
+	service := &ServiceB{breakers: []*shared.CircuitBreaker{viacep, shared.NewCircuitBreaker("openmeteo", policy, meter)}}
+
+	generation, _ := viacep.Allow()
+	viacep.Record(generation, false)
+	rec := httptest.NewRecorder()
+	service.healthCheck(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var response healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || response.Status != "degraded" {
+		t.Errorf("health = %d %q, want 200 degraded", rec.Code, response.Status)
+	}
+	if response.CircuitBreakers["viacep"] != shared.CircuitOpen || response.CircuitBreakers["openmeteo"] != shared.CircuitClosed {
+		t.Errorf("circuit breakers = %v", response.CircuitBreakers)
+	}
+}
+
+func TestHandleWeatherRequestCircuitOpen(t *testing.T) {
+	weather, err := NewCompositeWeatherProvider(WeatherModeFailover, time.Second, testLogger(),
+		&fakeWeatherProvider{name: "weatherapi", err: fmt.Errorf("%w: weatherapi: %w", ErrWeatherUnavailable, shared.ErrCircuitOpen)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &ServiceB{
+		logger:   testLogger(),
+		tracer:   sdktrace.NewTracerProvider().Tracer("test"),
+		meter:    shared.NewMeter(nil, "test"),
+		location: NewLocationChain(testLogger(), &fakeLocationProvider{name: "viacep"}),
+		weather:  weather,
+	}
+	rec := httptest.NewRecorder()
+	service.handleWeatherRequest(rec, httptest.NewRequest(http.MethodPost, "/weather", bytes.NewBufferString(`{"cep":"29902555"}`)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "weather service unavailable") {
+		t.Errorf("response = %d %s, want 503 weather service unavailable", rec.Code, rec.Body.String())
+	}
+}
+
+type slowLocationProvider struct {
+	budget    time.Duration
+	cancelled chan struct{}
+}
+
+func (p *slowLocationProvider) Name() string {
+	return "slow"
+}
+
+func (p *slowLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	deadline, _ := ctx.Deadline()
+	p.budget = time.Until(deadline)
+	<-ctx.Done()
+	close(p.cancelled)
+	return nil, fmt.Errorf("%w: %w", ErrLocationUnavailable, ctx.Err())
+}
+
+func TestHandleWeatherRequestBudgetExhausted(t *testing.T) {
+	upstream := &slowLocationProvider{cancelled: make(chan struct{})}
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	meter := shared.NewMeter(nil, "test")
+	cached := NewCachedLocationProvider(upstream, newLRUCache(10), time.Hour, time.Minute, meter, testLogger())
+	service := &ServiceB{
+		config:   shared.Config{LocationBudgetRatio: 0.4},
+		logger:   testLogger(),
+		tracer:   tracer,
+		meter:    meter,
+		location: NewCoalescingLocationProvider(cached, tracer),
+		weather:  &fakeWeatherProvider{name: "openmeteo", temp: 25},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/weather", bytes.NewBufferString(`{"cep":"29902555"}`))
+	req.Header.Set(shared.HeaderRequestBudget, "500")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	shared.DeadlineMiddleware(10*time.Second, http.HandlerFunc(service.handleWeatherRequest)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), "deadline exceeded") {
+		t.Errorf("response = %d %s, want 504 deadline exceeded", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("request took %s, should fail once the location share is spent", elapsed)
+	}
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream lookup should be cancelled with the request")
+	}
+	if upstream.budget > 200*time.Millisecond || upstream.budget < 150*time.Millisecond {
+		t.Errorf("upstream budget = %s, want 40%% of 500ms through the cache and coalescing layers", upstream.budget)
+	}
+}
+
+func TestHandleWeatherRequestProviderTimeout(t *testing.T) {
+	weather, err := NewCompositeWeatherProvider(WeatherModeFailover, 50*time.Millisecond, testLogger(),
+		&fakeWeatherProvider{name: "openmeteo", temp: 25, delay: time.Second},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &ServiceB{
+		logger:   testLogger(),
+		tracer:   sdktrace.NewTracerProvider().Tracer("test"),
+		meter:    shared.NewMeter(nil, "test"),
+		location: NewLocationChain(testLogger(), &fakeLocationProvider{name: "viacep"}),
+		weather:  weather,
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/weather", bytes.NewBufferString(`{"cep":"29902555"}`))
+	shared.DeadlineMiddleware(10*time.Second, http.HandlerFunc(service.handleWeatherRequest)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "error getting weather information") {
+		t.Errorf("response = %d %s, want 500: one provider timing out is not the request's deadline", rec.Code, rec.Body.String())
+	}
+}
+
+type delayedLocationProvider struct {
+	name      string
+	delay     time.Duration
+	calls     atomic.Int32
+	cancelled atomic.Bool
+}
+
+func (p *delayedLocationProvider) Name() string {
+	return p.name
+}
+
+func (p *delayedLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	p.calls.Add(1)
+	select {
+	case <-time.After(p.delay):
+		return &shared.Location{CEP: cep, City: "Linhares", State: "ES", Provider: p.name}, nil
+	case <-ctx.Done():
+		p.cancelled.Store(true)
+		return nil, fmt.Errorf("%w: %w", ErrLocationUnavailable, ctx.Err())
+	}
+}
+
+func TestHedgedLocationProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	primary := &delayedLocationProvider{name: "viacep", delay: time.Second}
+	secondary := &delayedLocationProvider{name: "brasilapi", delay: time.Millisecond}
+	hedged := NewHedgedLocationProvider(primary, secondary, 0.95, 20*time.Millisecond, tracer, testLogger())
+
+	ctx, span := tracer.Start(context.Background(), "lookup")
+	start := time.Now()
+	location, err := hedged.Lookup(ctx, "29902555")
+	span.End()
+	if err != nil || location.Provider != "brasilapi" {
+		t.Fatalf("Lookup = %+v, %v, want the hedge answer", location, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Lookup took %s, should not wait for the slow primary", elapsed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(recorder.Ended()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !primary.cancelled.Load() {
+		t.Error("primary lookup should be cancelled once the hedge wins")
+	}
+
+	results := map[string]string{}
+	for _, ended := range recorder.Ended() {
+		if ended.Name() != "service-b.location.attempt" {
+			continue
+		}
+		attrs := map[string]string{}
+		for _, attr := range ended.Attributes() {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+		results[attrs["location.hedge.attempt"]] = attrs["location.hedge.result"]
+	}
+	if results["primary"] != "cancelled" || results["hedge"] != "ok" {
+		t.Errorf("attempt results = %v", results)
+	}
+
+	primary.delay = time.Millisecond
+	if _, err := hedged.Lookup(context.Background(), "29902555"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := secondary.calls.Load(); calls != 1 {
+		t.Errorf("hedge calls = %d, want no hedge when the primary answers in time", calls)
+	}
+}
+
+func TestHedgedLocationProviderDelay(t *testing.T) {
+	hedged := NewHedgedLocationProvider(nil, nil, 0.9, 300*time.Millisecond, noop.NewTracerProvider().Tracer("test"), testLogger())
+	for i := range hedgeMinLatencySamples - 1 {
+		hedged.observe(time.Duration(i+1) * time.Millisecond)
+	}
+	if delay := hedged.hedgeDelay(); delay != 300*time.Millisecond {
+		t.Errorf("delay = %s, want the fixed delay with few samples", delay)
+	}
+	hedged.observe(20 * time.Millisecond)
+	if delay := hedged.hedgeDelay(); delay != 19*time.Millisecond {
+		t.Errorf("delay = %s, want p90 of 1..20ms", delay)
+	}
+}
+
+func TestHedgedLocationProviderObservesSuccesses(t *testing.T) {
+	primary := &fakeLocationProvider{name: "viacep", err: ErrLocationUnavailable}
+	secondary := &fakeLocationProvider{name: "brasilapi", err: ErrLocationUnavailable}
+	hedged := NewHedgedLocationProvider(primary, secondary, 0.95, time.Second, noop.NewTracerProvider().Tracer("test"), testLogger())
+	for range hedgeMinLatencySamples {
+		if _, err := hedged.Lookup(context.Background(), "29902555"); !errors.Is(err, ErrLocationUnavailable) {
+			t.Fatalf("Lookup error = %v, want ErrLocationUnavailable", err)
+		}
+	}
+	if delay := hedged.hedgeDelay(); delay != time.Second {
+		t.Errorf("delay = %s, failed lookups should not count as latency samples", delay)
+	}
+
+	primary.err = nil
+	for range hedgeMinLatencySamples {
+		if _, err := hedged.Lookup(context.Background(), "29902555"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if delay := hedged.hedgeDelay(); delay >= time.Second {
+		t.Errorf("delay = %s, want the percentile of successful lookups", delay)
+	}
+}
+
+func TestHedgedLocationProviderSamplesCancelledPrimary(t *testing.T) {
+	primary := &delayedLocationProvider{name: "viacep", delay: time.Millisecond}
+	secondary := &delayedLocationProvider{name: "brasilapi", delay: 10 * time.Millisecond}
+	hedged := NewHedgedLocationProvider(primary, secondary, 0.5, time.Second, noop.NewTracerProvider().Tracer("test"), testLogger())
+	lookup := func(n int) {
+		for range n {
+			if _, err := hedged.Lookup(context.Background(), "29902555"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	lookup(hedgeMinLatencySamples)
+	if delay := hedged.hedgeDelay(); delay >= 10*time.Millisecond {
+		t.Fatalf("delay = %s, want the median of fast lookups", delay)
+	}
+
+	primary.delay = time.Second
+	lookup(hedgeMinLatencySamples + 1)
+	if delay := hedged.hedgeDelay(); delay < 10*time.Millisecond {
+		t.Errorf("delay = %s, a primary that lost to the hedge should count as at least the time it ran", delay)
+	}
+}
+
+func TestNewLocationHedge(t *testing.T) {
+	providers := []LocationProvider{&fakeLocationProvider{name: "viacep"}, &fakeLocationProvider{name: "brasilapi"}, &fakeLocationProvider{name: "opencep"}}
+	for target, want := range map[string]string{
+		HedgeTargetSame: "viacep,brasilapi,opencep",
+		HedgeTargetNext: "brasilapi,opencep,viacep",
+	} {
+		hedge, err := newLocationHedge(target, testLogger(), providers)
+		if err != nil || hedge.Name() != want {
+			t.Errorf("newLocationHedge(%s) = %v, %v, want %s", target, hedge, err, want)
+		}
+	}
+	if _, err := newLocationHedge("random", testLogger(), providers); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
+
+func TestHandleWeatherRequestBulkheadFull(t *testing.T) {
+	full := fmt.Errorf("%w: viacep: %w", ErrLocationUnavailable, shared.ErrBulkheadFull)
+	service := &ServiceB{
+		logger:   testLogger(),
+		tracer:   sdktrace.NewTracerProvider().Tracer("test"),
+		meter:    shared.NewMeter(nil, "test"),
+		location: NewLocationChain(testLogger(), &fakeLocationProvider{name: "viacep", err: full}),
+		weather:  &fakeWeatherProvider{name: "openmeteo", temp: 25},
+	}
+	rec := httptest.NewRecorder()
+	service.handleWeatherRequest(rec, httptest.NewRequest(http.MethodPost, "/weather", bytes.NewBufferString(`{"cep":"29902555"}`)))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != bulkheadRetryAfter {
+		t.Errorf("response = %d, Retry-After %q, want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+// flightGroup coalesces concurrent calls with the same key: the first
+// caller (the leader) runs fn and every caller arriving before it finishes
+// waits for its result. The leader's work gets its own span and each
+// waiter's span links to it, so traces show which request did the call.
+type flightGroup[T any] struct {
+	name   string
+	tracer trace.Tracer
+	mu     sync.Mutex
+	calls  map[string]*flightCall[T]
+}
+
+type flightCall[T any] struct {
+	done     chan struct{}
+	span     trace.SpanContext
+	cancel   context.CancelFunc
+	deadline time.Time
+	waiters  int
+	pending  int
+	value    T
+	err      error
+}
+
+func newFlightGroup[T any](name string, tracer trace.Tracer) *flightGroup[T] {
+	return &flightGroup[T]{name: name, tracer: tracer, calls: map[string]*flightCall[T]{}}
+}
+
+// Do returns fn's result for key, running fn only if no call for key is in
+// flight. fn runs detached from the leader's cancellation so one caller
+// giving up does not fail the others, but keeps the leader's deadline; each
+// caller still stops waiting when its own context is done, and fn is
+// cancelled once no caller is left. A caller whose deadline is later than
+// the one the shared call ran out of starts over instead of failing with it.
+func (g *flightGroup[T]) Do(ctx context.Context, key string, fn func(context.Context) (T, error)) (T, error) {
+	for {
+		value, call, err := g.do(ctx, key, fn)
+		if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil || !call.expiredBefore(ctx) {
+			return value, err
+		}
+	}
+}
+
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(context.Context) (T, error)) (T, *flightCall[T], error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		call.pending++
+		g.mu.Unlock()
+		value, err := g.wait(ctx, key, call)
+		return value, call, err
+	}
+	leaderCtx, cancel := detach(ctx)
+	leaderCtx, span := shared.CreateSpan(leaderCtx, g.tracer, "service-b."+g.name+".fetch",
+		trace.WithAttributes(attribute.String("singleflight.key", key)),
+	)
+	call := &flightCall[T]{done: make(chan struct{}), span: span.SpanContext(), cancel: cancel, pending: 1}
+	call.deadline, _ = leaderCtx.Deadline()
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	go func() {
+		defer span.End()
+		call.value, call.err = fn(leaderCtx)
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		span.SetAttributes(attribute.Int("singleflight.waiters", call.waiters))
+		g.mu.Unlock()
+		cancel()
+		close(call.done)
+	}()
+	value, err := g.await(ctx, key, call)
+	return value, call, err
+}
+
+// expiredBefore reports whether call ran with a deadline earlier than
+// ctx's, so a caller with ctx still has time for a call of its own.
+func (c *flightCall[T]) expiredBefore(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return !c.deadline.IsZero() && (!ok || c.deadline.Before(deadline))
+}
+
+// detach returns a context with ctx's values and deadline that is not
+// cancelled with ctx.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+func (g *flightGroup[T]) wait(ctx context.Context, key string, call *flightCall[T]) (T, error) {
+	_, span := shared.CreateSpan(ctx, g.tracer, "service-b."+g.name+".wait",
+		trace.WithLinks(trace.Link{
+			SpanContext: call.span,
+			Attributes:  []attribute.KeyValue{attribute.String("singleflight.role", "leader")},
+		}),
+		trace.WithAttributes(
+			attribute.String("singleflight.key", key),
+			attribute.Bool("singleflight.shared", true),
+		),
+	)
+	defer span.End()
+	return g.await(ctx, key, call)
+}
+
+// await waits for call or for ctx. The last caller to give up cancels fn
+// and forgets the call, so later callers start a fresh one.
+func (g *flightGroup[T]) await(ctx context.Context, key string, call *flightCall[T]) (T, error) {
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+	}
+	g.mu.Lock()
+	call.pending--
+	if call.pending == 0 {
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		call.cancel()
+	}
+	g.mu.Unlock()
+	var zero T
+	return zero, ctx.Err()
+}
+
+// CoalescingLocationProvider shares one lookup between concurrent requests
+// for the same CEP. Every caller gets its own copy of the location.
+type CoalescingLocationProvider struct {
+	next  LocationProvider
+	group *flightGroup[*shared.Location]
+}
+
+func NewCoalescingLocationProvider(next LocationProvider, tracer trace.Tracer) *CoalescingLocationProvider {
+	return &CoalescingLocationProvider{next: next, group: newFlightGroup[*shared.Location]("location", tracer)}
+}
+
+func (c *CoalescingLocationProvider) Name() string {
+	return c.next.Name()
+}
+
+func (c *CoalescingLocationProvider) Lookup(ctx context.Context, cep string) (*shared.Location, error) {
+	location, err := c.group.Do(ctx, cep, func(ctx context.Context) (*shared.Location, error) {
+		return c.next.Lookup(ctx, cep)
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *location
+	return &copied, nil
+}
+
+// CoalescingWeatherProvider shares one fetch between concurrent requests
+// for the same location, keyed like the weather cache.
+type CoalescingWeatherProvider struct {
+	next  WeatherProvider
+	group *flightGroup[*shared.WeatherConditions]
+}
+
+func NewCoalescingWeatherProvider(next WeatherProvider, tracer trace.Tracer) *CoalescingWeatherProvider {
+	return &CoalescingWeatherProvider{next: next, group: newFlightGroup[*shared.WeatherConditions]("weather", tracer)}
+}
+
+func (c *CoalescingWeatherProvider) Name() string {
+	return c.next.Name()
+}
+
+func (c *CoalescingWeatherProvider) Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	conditions, err := c.group.Do(ctx, weatherCacheKey(location), func(ctx context.Context) (*shared.WeatherConditions, error) {
+		return c.next.Current(ctx, location)
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *conditions
+	return &copied, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"weather-getter-otel/shared"
+)
+
+// StatusError is returned by upstreamClient when the upstream answered
+// with something other than 200 OK.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status code %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// upstreamClient holds what every HTTP based provider needs to call its
+// upstream and record the call in logs and metrics.
+type upstreamClient struct {
+	name    string
+	baseURL string
+	client  *http.Client
+	logger  *shared.Logger
+	meter   *shared.Meter
+}
+
+func newUpstreamClient(name, baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) upstreamClient {
+	return upstreamClient{
+		name:    name,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+		logger:  logger.Component(name),
+		meter:   meter,
+	}
+}
+
+func (c *upstreamClient) Name() string {
+	return c.name
+}
+
+func (c *upstreamClient) getJSON(ctx context.Context, apiURL string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.logger.DebugCtx(ctx, "Fazendo requisição para upstream", map[string]interface{}{
+		"endpoint": shared.RedactURL(req.URL),
+	})
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	c.meter.RecordUpstream(c.name, time.Since(start), resp, err)
+	if err != nil {
+		c.logger.ErrorCtx(ctx, "Falha na requisição HTTP", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Errorf("error contacting %s: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		c.logger.ErrorCtx(ctx, "Upstream retornou status inválido", map[string]interface{}{
+			"status_code": resp.StatusCode,
+			"response":    string(body),
+		})
+		return &StatusError{Provider: c.name, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		c.logger.ErrorCtx(ctx, "Erro ao decodificar resposta", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Errorf("error decoding %s response: %w", c.name, err)
+	}
+	return nil
+}
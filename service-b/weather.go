@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"weather-getter-otel/shared"
+)
+
+var ErrWeatherUnavailable = errors.New("weather provider unavailable")
+
+type WeatherProvider interface {
+	Name() string
+	Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error)
+}
+
+func NewWeatherProvider(name string, config shared.Config, client *http.Client, logger *shared.Logger, meter *shared.Meter) (WeatherProvider, error) {
+	switch name {
+	case "weatherapi":
+		return NewWeatherAPIProvider(config.WeatherAPIURL, config.WeatherAPIKey, client, logger, meter), nil
+	case "openmeteo":
+		return NewOpenMeteoProvider(config.OpenMeteoURL, client, logger, meter), nil
+	default:
+		return nil, fmt.Errorf("unknown weather provider %q", name)
+	}
+}
+
+type WeatherAPIProvider struct {
+	upstreamClient
+	apiKey string
+}
+
+func NewWeatherAPIProvider(baseURL, apiKey string, client *http.Client, logger *shared.Logger, meter *shared.Meter) *WeatherAPIProvider {
+	return &WeatherAPIProvider{upstreamClient: newUpstreamClient("weatherapi", baseURL, client, logger, meter), apiKey: apiKey}
+}
+
+func (p *WeatherAPIProvider) Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	p.logger.DebugCtx(ctx, "Verificando chave de API", map[string]interface{}{
+		"key_length": len(p.apiKey),
+	})
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("%w: WEATHER_API_KEY environment variable not set", ErrWeatherUnavailable)
+	}
+	if location.Latitude == nil || location.Longitude == nil {
+		return nil, fmt.Errorf("%w: no coordinates for %s", ErrWeatherUnavailable, location.City)
+	}
+	query := fmt.Sprintf("%f,%f", *location.Latitude, *location.Longitude)
+	params := url.Values{"key": {p.apiKey}, "q": {query}, "aqi": {"no"}}
+	var resp shared.WeatherAPIResponse
+	if err := p.getJSON(ctx, p.baseURL+"/v1/current.json?"+params.Encode(), &resp); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWeatherUnavailable, err)
+	}
+	p.logger.InfoCtx(ctx, "Dados de clima obtidos com sucesso", map[string]interface{}{
+		"city":    location.City,
+		"temp_c":  resp.Current.TempC,
+		"country": resp.Location.Country,
+	})
+	return &shared.WeatherConditions{
+		TempC:      resp.Current.TempC,
+		Humidity:   resp.Current.Humidity,
+		WindKPH:    resp.Current.WindKPH,
+		ObservedAt: time.Unix(resp.Current.LastUpdatedEpoch, 0).UTC(),
+		Provider:   p.name,
+	}, nil
+}
+
+type OpenMeteoProvider struct {
+	upstreamClient
+}
+
+func NewOpenMeteoProvider(baseURL string, client *http.Client, logger *shared.Logger, meter *shared.Meter) *OpenMeteoProvider {
+	return &OpenMeteoProvider{upstreamClient: newUpstreamClient("openmeteo", baseURL, client, logger, meter)}
+}
+
+func (p *OpenMeteoProvider) Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	if location.Latitude == nil || location.Longitude == nil {
+		return nil, fmt.Errorf("%w: no coordinates for %s", ErrWeatherUnavailable, location.City)
+	}
+	params := url.Values{
+		"latitude":        {strconv.FormatFloat(*location.Latitude, 'f', -1, 64)},
+		"longitude":       {strconv.FormatFloat(*location.Longitude, 'f', -1, 64)},
+		"current":         {"temperature_2m,relative_humidity_2m,wind_speed_10m"},
+		"wind_speed_unit": {"kmh"},
+		"timeformat":      {"unixtime"},
+	}
+	var resp shared.OpenMeteoResponse
+	if err := p.getJSON(ctx, p.baseURL+"/v1/forecast?"+params.Encode(), &resp); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWeatherUnavailable, err)
+	}
+	p.logger.InfoCtx(ctx, "Dados de clima obtidos com sucesso", map[string]interface{}{
+		"city":   location.City,
+		"temp_c": resp.Current.Temperature,
+	})
+	return &shared.WeatherConditions{
+		TempC:      resp.Current.Temperature,
+		Humidity:   resp.Current.RelativeHumidity,
+		WindKPH:    resp.Current.WindSpeed,
+		ObservedAt: time.Unix(resp.Current.Time, 0).UTC(),
+		Provider:   p.name,
+	}, nil
+}
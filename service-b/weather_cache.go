@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+const weatherRefreshTimeout = 30 * time.Second
+
+// CachedWeatherProvider keeps current conditions per location for ttl. For
+// another staleTTL after that the cached conditions are still served while
+// a single background request refreshes them (stale-while-revalidate).
+// Cache failures are logged and treated as misses.
+type CachedWeatherProvider struct {
+	next     WeatherProvider
+	cache    Cache
+	ttl      time.Duration
+	staleTTL time.Duration
+	meter    *shared.Meter
+	logger   *shared.Logger
+	now      func() time.Time
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+type weatherCacheEntry struct {
+	Conditions shared.WeatherConditions `json:"conditions"`
+	FetchedAt  time.Time                `json:"fetched_at"`
+}
+
+func NewCachedWeatherProvider(next WeatherProvider, cache Cache, ttl, staleTTL time.Duration, meter *shared.Meter, logger *shared.Logger) *CachedWeatherProvider {
+	return &CachedWeatherProvider{
+		next:       next,
+		cache:      cache,
+		ttl:        ttl,
+		staleTTL:   staleTTL,
+		meter:      meter,
+		logger:     logger.Component("weather"),
+		now:        time.Now,
+		refreshing: map[string]bool{},
+	}
+}
+
+func (c *CachedWeatherProvider) Name() string {
+	return c.next.Name()
+}
+
+func (c *CachedWeatherProvider) Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	span := trace.SpanFromContext(ctx)
+	key := weatherCacheKey(location)
+	if entry, ok := c.get(ctx, key); ok {
+		stale := c.now().Sub(entry.FetchedAt) >= c.ttl
+		c.meter.RecordCache("weather", true)
+		span.SetAttributes(
+			attribute.Bool("weather.cache.hit", true),
+			attribute.Bool("weather.cache.stale", stale),
+			attribute.String("weather.cache.key", key),
+		)
+		if stale {
+			c.refresh(ctx, key, location)
+		}
+		return &entry.Conditions, nil
+	}
+	c.meter.RecordCache("weather", false)
+	span.SetAttributes(
+		attribute.Bool("weather.cache.hit", false),
+		attribute.String("weather.cache.key", key),
+	)
+	return c.fetch(ctx, key, location)
+}
+
+func (c *CachedWeatherProvider) fetch(ctx context.Context, key string, location *shared.Location) (*shared.WeatherConditions, error) {
+	conditions, err := c.next.Current(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(weatherCacheEntry{Conditions: *conditions, FetchedAt: c.now()})
+	if err == nil {
+		err = c.cache.Set(ctx, key, value, c.ttl+c.staleTTL)
+	}
+	if err != nil {
+		c.logger.WarnCtx(ctx, "Falha ao gravar clima no cache", map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		})
+	}
+	return conditions, nil
+}
+
+func (c *CachedWeatherProvider) get(ctx context.Context, key string) (weatherCacheEntry, bool) {
+	var entry weatherCacheEntry
+	value, ok, err := c.cache.Get(ctx, key)
+	if err == nil && ok {
+		err = json.Unmarshal(value, &entry)
+	}
+	if err != nil {
+		c.logger.WarnCtx(ctx, "Falha ao ler clima do cache", map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		})
+		return entry, false
+	}
+	return entry, ok
+}
+
+// refresh fetches the conditions again in the background, at most once per
+// key at a time. It keeps the request's trace but not its cancellation.
+func (c *CachedWeatherProvider) refresh(ctx context.Context, key string, location *shared.Location) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), weatherRefreshTimeout)
+	copied := *location
+	go func() {
+		defer cancel()
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		if _, err := c.fetch(ctx, key, &copied); err != nil {
+			c.logger.WarnCtx(ctx, "Falha ao atualizar clima em cache", map[string]interface{}{
+				"key":   key,
+				"error": err.Error(),
+			})
+		}
+	}()
+}
+
+// weatherCacheKey normalizes a location so every CEP of the same
+// municipality, or of the same ~1km area, shares one entry.
+func weatherCacheKey(location *shared.Location) string {
+	switch {
+	case location.IBGE != "":
+		return "weather:ibge:" + location.IBGE
+	case location.Latitude != nil && location.Longitude != nil:
+		return fmt.Sprintf("weather:coord:%.2f,%.2f", roundCoordinate(*location.Latitude), roundCoordinate(*location.Longitude))
+	default:
+		return "weather:city:" + strings.ToLower(strings.TrimSpace(location.City)) + "/" + strings.ToUpper(strings.TrimSpace(location.State))
+	}
+}
+
+func roundCoordinate(value float64) float64 {
+	return math.Round(value*100) / 100
+}
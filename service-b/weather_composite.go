@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"weather-getter-otel/shared"
+)
+
+const (
+	WeatherModeFailover  = "failover"
+	WeatherModeConsensus = "consensus"
+)
+
+// CompositeWeatherProvider queries several providers either one after the
+// other until one answers (failover) or all at once, combining the answers
+// into the median (consensus). Every provider gets its own timeout.
+type CompositeWeatherProvider struct {
+	providers []WeatherProvider
+	mode      string
+	timeout   time.Duration
+	logger    *shared.Logger
+}
+
+type weatherResult struct {
+	provider   string
+	conditions *shared.WeatherConditions
+	err        error
+	latency    time.Duration
+}
+
+func NewCompositeWeatherProvider(mode string, timeout time.Duration, logger *shared.Logger, providers ...WeatherProvider) (*CompositeWeatherProvider, error) {
+	if mode != WeatherModeFailover && mode != WeatherModeConsensus {
+		return nil, fmt.Errorf("unknown weather mode %q", mode)
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no weather providers configured")
+	}
+	return &CompositeWeatherProvider{
+		providers: providers,
+		mode:      mode,
+		timeout:   timeout,
+		logger:    logger.Component("weather"),
+	}, nil
+}
+
+func (c *CompositeWeatherProvider) Name() string {
+	names := make([]string, len(c.providers))
+	for i, provider := range c.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *CompositeWeatherProvider) Current(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("weather.mode", c.mode))
+	if c.mode == WeatherModeConsensus {
+		return c.consensus(ctx, location)
+	}
+	return c.failover(ctx, location)
+}
+
+func (c *CompositeWeatherProvider) failover(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	var errs []error
+	for _, provider := range c.providers {
+		result := c.query(ctx, provider, location)
+		if result.err == nil {
+			return result.conditions, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrWeatherUnavailable, ctx.Err())
+		}
+		c.logger.WarnCtx(ctx, "Provider de clima falhou, tentando o próximo", map[string]interface{}{
+			"provider": provider.Name(),
+			"error":    result.err.Error(),
+		})
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), result.err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *CompositeWeatherProvider) consensus(ctx context.Context, location *shared.Location) (*shared.WeatherConditions, error) {
+	results := make([]weatherResult, len(c.providers))
+	var wg sync.WaitGroup
+	for i, provider := range c.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.query(ctx, provider, location)
+		}()
+	}
+	wg.Wait()
+
+	var answers []*shared.WeatherConditions
+	var errs []error
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.provider, result.err))
+			continue
+		}
+		answers = append(answers, result.conditions)
+	}
+	if len(answers) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		c.logger.WarnCtx(ctx, "Consenso de clima calculado sem alguns providers", map[string]interface{}{
+			"error": errors.Join(errs...).Error(),
+		})
+	}
+	return combineConditions(answers), nil
+}
+
+func (c *CompositeWeatherProvider) query(ctx context.Context, provider WeatherProvider, location *shared.Location) weatherResult {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	conditions, err := provider.Current(ctx, location)
+	result := weatherResult{provider: provider.Name(), conditions: conditions, err: err, latency: time.Since(start)}
+
+	prefix := "weather." + provider.Name() + "."
+	attrs := []attribute.KeyValue{attribute.Int64(prefix+"latency_ms", result.latency.Milliseconds())}
+	switch {
+	case err == nil:
+		attrs = append(attrs, attribute.String(prefix+"result", "ok"), attribute.Float64(prefix+"temp_c", conditions.TempC))
+	case errors.Is(err, context.DeadlineExceeded):
+		attrs = append(attrs, attribute.String(prefix+"result", "timeout"))
+	default:
+		attrs = append(attrs, attribute.String(prefix+"result", "error"))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+	return result
+}
+
+// combineConditions takes the median of each measurement and reports the
+// temperature spread between the providers that answered.
+func combineConditions(answers []*shared.WeatherConditions) *shared.WeatherConditions {
+	temps := make([]float64, len(answers))
+	humidity := make([]float64, len(answers))
+	wind := make([]float64, len(answers))
+	providers := make([]string, len(answers))
+	observedAt := answers[0].ObservedAt
+	for i, answer := range answers {
+		temps[i] = answer.TempC
+		humidity[i] = answer.Humidity
+		wind[i] = answer.WindKPH
+		providers[i] = answer.Provider
+		if answer.ObservedAt.Before(observedAt) {
+			observedAt = answer.ObservedAt
+		}
+	}
+	median := func(values []float64) float64 {
+		sort.Float64s(values)
+		middle := len(values) / 2
+		if len(values)%2 == 0 {
+			return (values[middle-1] + values[middle]) / 2
+		}
+		return values[middle]
+	}
+	temp := median(temps)
+	spread := temps[len(temps)-1] - temps[0]
+	return &shared.WeatherConditions{
+		TempC:      temp,
+		SpreadC:    &spread,
+		Humidity:   median(humidity),
+		WindKPH:    median(wind),
+		ObservedAt: observedAt,
+		Provider:   strings.Join(providers, ","),
+	}
+}
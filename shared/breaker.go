@@ -0,0 +1,217 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+
+	circuitBuckets = 10
+)
+
+// ErrCircuitOpen is returned without calling the upstream while its circuit
+// breaker is open, or half-open with a probe already in flight.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerPolicy configures when a circuit breaker opens: once at
+// least MinRequests calls were made in the last Window and FailureRatio of
+// them failed. After Cooldown a single probe call is let through
+// (half-open); its outcome closes or reopens the circuit.
+type CircuitBreakerPolicy struct {
+	Enabled      bool
+	FailureRatio float64
+	MinRequests  int
+	Window       time.Duration
+	Cooldown     time.Duration
+}
+
+// CircuitBreaker tracks the outcome of calls to one upstream over a rolling
+// window split in buckets.
+type CircuitBreaker struct {
+	name   string
+	policy CircuitBreakerPolicy
+	meter  *Meter
+	now    func() time.Time
+
+	mu         sync.Mutex
+	state      string
+	generation uint64
+	openedAt   time.Time
+	probing    bool
+	buckets    [circuitBuckets]circuitBucket
+}
+
+type circuitBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+func NewCircuitBreaker(name string, policy CircuitBreakerPolicy, meter *Meter) *CircuitBreaker {
+	b := &CircuitBreaker{name: name, policy: policy, meter: meter, now: time.Now, state: CircuitClosed}
+	meter.RecordCircuitState(name, CircuitClosed)
+	return b
+}
+
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+// State returns the current state, moving an open circuit whose cooldown
+// elapsed to half-open.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cooldownElapsed()
+	return b.state
+}
+
+// Allow reports whether a call may go to the upstream and returns the
+// generation it was allowed in; the generation changes with every state
+// change. Every allowed call must be followed by Record or Forget with that
+// generation.
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cooldownElapsed()
+	switch {
+	case b.state == CircuitOpen, b.state == CircuitHalfOpen && b.probing:
+		b.meter.RecordCircuitRejection(b.name)
+		return b.generation, fmt.Errorf("%s: %w", b.name, ErrCircuitOpen)
+	case b.state == CircuitHalfOpen:
+		b.probing = true
+	}
+	return b.generation, nil
+}
+
+// Record registers the outcome of a call allowed by Allow. Outcomes of
+// calls allowed before the last state change are ignored, so a slow call
+// from the closed circuit cannot decide a half-open probe.
+func (b *CircuitBreaker) Record(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+		if success {
+			b.buckets = [circuitBuckets]circuitBucket{}
+			b.setState(CircuitClosed)
+		} else {
+			b.open()
+		}
+		return
+	}
+	if b.state != CircuitClosed {
+		return
+	}
+	bucket := b.bucket()
+	if success {
+		bucket.successes++
+		return
+	}
+	bucket.failures++
+	total, failures := b.counts()
+	if total >= b.policy.MinRequests && float64(failures) >= b.policy.FailureRatio*float64(total) {
+		b.open()
+	}
+}
+
+// Forget releases a call allowed by Allow whose outcome says nothing about
+// the upstream, such as one cancelled by the caller.
+func (b *CircuitBreaker) Forget(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation {
+		b.probing = false
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.openedAt = b.now()
+	b.setState(CircuitOpen)
+}
+
+func (b *CircuitBreaker) cooldownElapsed() {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.policy.Cooldown {
+		b.setState(CircuitHalfOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	b.state = state
+	b.generation++
+	b.meter.RecordCircuitState(b.name, state)
+}
+
+// bucket returns the bucket for now, recycling it if it belongs to an
+// earlier pass over the window.
+func (b *CircuitBreaker) bucket() *circuitBucket {
+	width := max(b.policy.Window/circuitBuckets, time.Millisecond)
+	start := b.now().Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%circuitBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *CircuitBreaker) counts() (total, failures int) {
+	since := b.now().Add(-b.policy.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(since) {
+			total += bucket.successes + bucket.failures
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+// CircuitBreakerTransport guards an upstream with a CircuitBreaker. Network
+// errors, 429 and 5xx responses count as failures; calls cancelled by the
+// caller are not counted. The breaker state is added to the caller's span
+// as circuit_breaker.<name>.state.
+type CircuitBreakerTransport struct {
+	base    http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+func NewCircuitBreakerTransport(base http.RoundTripper, breaker *CircuitBreaker) *CircuitBreakerTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &CircuitBreakerTransport{base: base, breaker: breaker}
+}
+
+func (t *CircuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := trace.SpanFromContext(req.Context())
+	stateKey := attribute.Key("circuit_breaker." + t.breaker.name + ".state")
+	generation, err := t.breaker.Allow()
+	if err != nil {
+		span.SetAttributes(stateKey.String(CircuitOpen))
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		t.breaker.Forget(generation)
+	case err != nil:
+		t.breaker.Record(generation, false)
+	default:
+		t.breaker.Record(generation, resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError)
+	}
+	span.SetAttributes(stateKey.String(t.breaker.State()))
+	return resp, err
+}
@@ -0,0 +1,167 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func testCircuitBreaker(meter *Meter) (*CircuitBreaker, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	breaker := NewCircuitBreaker("viacep", CircuitBreakerPolicy{
+		Enabled:      true,
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       10 * time.Second,
+		Cooldown:     5 * time.Second,
+	}, meter)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	meter := NewMeter(nil, "test")
+	breaker, now := testCircuitBreaker(meter)
+	upstream := attribute.String("upstream", "viacep")
+
+	for _, success := range []bool{true, false, true} {
+		generation, err := breaker.Allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		breaker.Record(generation, success)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatal("breaker should stay closed below MinRequests")
+	}
+	generation, _ := breaker.Allow()
+	breaker.Record(generation, false)
+	if breaker.State() != CircuitOpen || metricValue(meter, "circuit_breaker_state", upstream) != 2 {
+		t.Fatalf("state = %s, gauge = %v, want open", breaker.State(), metricValue(meter, "circuit_breaker_state", upstream))
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() = %v, want ErrCircuitOpen", err)
+	}
+	if metricValue(meter, "circuit_breaker_rejections_total", upstream) != 1 {
+		t.Errorf("rejections = %v, want 1", metricValue(meter, "circuit_breaker_rejections_total", upstream))
+	}
+
+	*now = now.Add(5 * time.Second)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("state = %s, want half-open after cooldown", breaker.State())
+	}
+	probe, err := breaker.Allow()
+	if err != nil {
+		t.Fatal("probe should be allowed")
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("only one probe should be allowed while half-open")
+	}
+	breaker.Record(probe, false)
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("state = %s, want open after failed probe", breaker.State())
+	}
+
+	*now = now.Add(5 * time.Second)
+	probe, _ = breaker.Allow()
+	breaker.Record(probe, true)
+	if breaker.State() != CircuitClosed || metricValue(meter, "circuit_breaker_state", upstream) != 0 {
+		t.Fatalf("state = %s, want closed after successful probe", breaker.State())
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	breaker, now := testCircuitBreaker(NewMeter(nil, "test"))
+	for range 3 {
+		generation, _ := breaker.Allow()
+		breaker.Record(generation, false)
+	}
+	*now = now.Add(11 * time.Second)
+	for _, success := range []bool{false, true, true} {
+		generation, _ := breaker.Allow()
+		breaker.Record(generation, success)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("state = %s, failures outside the window should not count", breaker.State())
+	}
+}
+
+func TestCircuitBreakerStaleOutcome(t *testing.T) {
+	breaker, now := testCircuitBreaker(NewMeter(nil, "test"))
+	slow, _ := breaker.Allow()
+	cancelled, _ := breaker.Allow()
+	for range 4 {
+		generation, _ := breaker.Allow()
+		breaker.Record(generation, false)
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("state = %s, want open", breaker.State())
+	}
+
+	*now = now.Add(5 * time.Second)
+	probe, err := breaker.Allow()
+	if err != nil {
+		t.Fatal("probe should be allowed")
+	}
+	breaker.Record(slow, true)
+	breaker.Forget(cancelled)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("state = %s, a call from the closed circuit should not decide the probe", breaker.State())
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("a call from the closed circuit should not release the probe")
+	}
+	breaker.Record(probe, false)
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("state = %s, want open after failed probe", breaker.State())
+	}
+	breaker.Record(probe, true)
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("state = %s, a probe should only be recorded once", breaker.State())
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	breaker, _ := testCircuitBreaker(NewMeter(nil, "test"))
+	client := &http.Client{Transport: NewCircuitBreakerTransport(nil, breaker)}
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	for range 4 {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	ctx, span := tracer.Start(context.Background(), "lookup")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err := client.Do(req)
+	span.End()
+	if !errors.Is(err, ErrCircuitOpen) || calls.Load() != 4 {
+		t.Fatalf("err = %v after %d calls, want ErrCircuitOpen after 4", err, calls.Load())
+	}
+	state := ""
+	for _, attr := range recorder.Ended()[0].Attributes() {
+		if attr.Key == "circuit_breaker.viacep.state" {
+			state = attr.Value.AsString()
+		}
+	}
+	if state != CircuitOpen {
+		t.Errorf("span circuit_breaker.viacep.state = %q, want open", state)
+	}
+}
@@ -0,0 +1,106 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrBulkheadFull is returned without calling the upstream when all of its
+// concurrency slots are taken and its wait queue is full.
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// BulkheadPolicy limits the calls in flight to one upstream to
+// MaxConcurrent; up to MaxQueue more calls wait for a free slot, for as
+// long as their context allows, and any call beyond that is rejected.
+type BulkheadPolicy struct {
+	Enabled       bool
+	MaxConcurrent int
+	MaxQueue      int
+}
+
+type Bulkhead struct {
+	name   string
+	policy BulkheadPolicy
+	meter  *Meter
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	queued int
+}
+
+func NewBulkhead(name string, policy BulkheadPolicy, meter *Meter) *Bulkhead {
+	meter.RecordBulkheadQueue(name, 0)
+	return &Bulkhead{name: name, policy: policy, meter: meter, slots: make(chan struct{}, policy.MaxConcurrent)}
+}
+
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// Acquire takes a slot, waiting in the queue if needed. The returned
+// function gives the slot back.
+func (b *Bulkhead) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	default:
+	}
+	b.mu.Lock()
+	if b.queued >= b.policy.MaxQueue {
+		b.mu.Unlock()
+		b.meter.RecordBulkheadRejection(b.name)
+		return nil, fmt.Errorf("%s: %w", b.name, ErrBulkheadFull)
+	}
+	b.queued++
+	b.meter.RecordBulkheadQueue(b.name, b.queued)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.queued--
+		b.meter.RecordBulkheadQueue(b.name, b.queued)
+		b.mu.Unlock()
+	}()
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+}
+
+// BulkheadTransport guards an upstream with a Bulkhead. The slot is held
+// until the response headers arrive. Rejected calls are marked on the
+// caller's span with bulkhead.<name>.rejected.
+type BulkheadTransport struct {
+	base     http.RoundTripper
+	bulkhead *Bulkhead
+}
+
+func NewBulkheadTransport(base http.RoundTripper, bulkhead *Bulkhead) *BulkheadTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &BulkheadTransport{base: base, bulkhead: bulkhead}
+}
+
+func (t *BulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.bulkhead.Acquire(req.Context())
+	if err != nil {
+		if errors.Is(err, ErrBulkheadFull) {
+			trace.SpanFromContext(req.Context()).SetAttributes(attribute.Bool("bulkhead."+t.bulkhead.name+".rejected", true))
+		}
+		return nil, err
+	}
+	defer release()
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestBulkhead(t *testing.T) {
+	meter := NewMeter(nil, "test")
+	bulkhead := NewBulkhead("weatherapi", BulkheadPolicy{Enabled: true, MaxConcurrent: 1, MaxQueue: 1}, meter)
+	upstream := attribute.String("upstream", "weatherapi")
+
+	release, err := bulkhead.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() {
+		release, err := bulkhead.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	for metricValue(meter, "bulkhead_queue_depth", upstream) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := bulkhead.Acquire(context.Background()); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("Acquire() = %v, want ErrBulkheadFull with a full queue", err)
+	}
+	if metricValue(meter, "bulkhead_rejections_total", upstream) != 1 {
+		t.Errorf("rejections = %v, want 1", metricValue(meter, "bulkhead_rejections_total", upstream))
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("queued Acquire() = %v, want a slot once released", err)
+	}
+	if metricValue(meter, "bulkhead_queue_depth", upstream) != 0 {
+		t.Errorf("queue depth = %v, want 0", metricValue(meter, "bulkhead_queue_depth", upstream))
+	}
+
+	release, _ = bulkhead.Acquire(context.Background())
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := bulkhead.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() = %v, want the context error while queued", err)
+	}
+}
+
+func TestBulkheadTransport(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+	bulkhead := NewBulkhead("viacep", BulkheadPolicy{Enabled: true, MaxConcurrent: 1, MaxQueue: 1}, NewMeter(nil, "test"))
+	client := &http.Client{Transport: NewBulkheadTransport(nil, bulkhead)}
+
+	for range 2 {
+		go func() {
+			if resp, err := client.Get(server.URL); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	for {
+		bulkhead.mu.Lock()
+		queued := bulkhead.queued
+		bulkhead.mu.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Get() = %v, want ErrBulkheadFull", err)
+	}
+}
+
+func TestConfigBulkheadPolicies(t *testing.T) {
+	t.Setenv("BULKHEAD_MAX_QUEUE", "0")
+	t.Setenv("VIACEP_BULKHEAD_MAX_QUEUE", "5")
+	t.Setenv("WEATHERAPI_BULKHEAD_MAX_QUEUE", "-1")
+	t.Setenv("SERVICE_B_BULKHEAD_MAX_CONCURRENT", "1")
+	config := GetConfig()
+
+	if policy := config.BulkheadPolicyFor("openmeteo"); policy.MaxQueue != 0 {
+		t.Errorf("openmeteo queue = %d, want 0 from BULKHEAD_MAX_QUEUE", policy.MaxQueue)
+	}
+	if policy := config.BulkheadPolicyFor("viacep"); policy.MaxQueue != 5 {
+		t.Errorf("viacep queue = %d, want 5", policy.MaxQueue)
+	}
+	if policy := config.BulkheadPolicyFor("weatherapi"); policy.MaxQueue != 0 {
+		t.Errorf("weatherapi queue = %d, want BULKHEAD_MAX_QUEUE for a negative value", policy.MaxQueue)
+	}
+	if _, ok := config.Bulkheads["service-b"]; ok {
+		t.Error("service-b is not guarded by a bulkhead and should have no policy of its own")
+	}
+}
+
+func TestBulkheadWithoutQueue(t *testing.T) {
+	bulkhead := NewBulkhead("viacep", BulkheadPolicy{Enabled: true, MaxConcurrent: 1}, NewMeter(nil, "test"))
+	release, err := bulkhead.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if _, err := bulkhead.Acquire(context.Background()); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Acquire() = %v, want ErrBulkheadFull without a queue", err)
+	}
+}
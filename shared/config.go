@@ -1,34 +1,320 @@
 package shared
 
 import (
+	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port          string
 	LogLevel      string
 	LogJSON       bool
+	LogSource     bool
 	WeatherAPIKey string
 	ServiceBURL   string
 	ZipkinURL     string
+	ViaCEPURL     string
+	BrasilAPIURL  string
+	OpenCEPURL    string
+	PostmonURL    string
+
+	RequestTimeout      time.Duration
+	LocationBudgetRatio float64
+
+	WeatherProviders       []string
+	WeatherMode            string
+	WeatherProviderTimeout time.Duration
+	WeatherAPIURL          string
+	OpenMeteoURL           string
+	WeatherCacheTTL        time.Duration
+	WeatherCacheStaleTTL   time.Duration
+	WeatherCacheMaxEntries int
+
+	CacheBackend   string
+	RedisAddr      string
+	RedisPassword  string
+	RedisDB        int
+	RedisKeyPrefix string
+
+	LocationProviders       []string
+	CEPCacheTTL             time.Duration
+	CEPCacheNegativeTTL     time.Duration
+	CEPCacheMaxEntries      int
+	LocationHedge           bool
+	LocationHedgePercentile float64
+	LocationHedgeDelay      time.Duration
+	LocationHedgeTarget     string
+
+	Retry         RetryPolicy
+	RetryPolicies map[string]RetryPolicy
+
+	CircuitBreaker  CircuitBreakerPolicy
+	CircuitBreakers map[string]CircuitBreakerPolicy
+
+	Bulkhead  BulkheadPolicy
+	Bulkheads map[string]BulkheadPolicy
+
+	LogExporters      []string
+	LogLevelOverrides map[string]string
+	AdminToken        string
+
+	TraceExporters      []string
+	OTLPEndpoint        string
+	OTLPTracesEndpoint  string
+	OTLPMetricsEndpoint string
+	OTLPLogsEndpoint    string
+	OTLPHeaders         map[string]string
+	OTLPInsecure        bool
+
+	TraceSampler           string
+	TraceSamplerArg        float64
+	TraceSampleErrors      bool
+	TraceSampleCEPPrefixes []string
+
+	MetricsExporters      []string
+	MetricsExportInterval time.Duration
 }
 
 func GetConfig() Config {
 	port := getEnv("PORT", "8080")
 	logLevel := getEnv("LOG_LEVEL", "INFO")
 	logJSON := getEnvBool("LOG_JSON", false)
+	logSource := getEnvBool("LOG_SOURCE", false)
 	weatherAPIKey := getEnv("WEATHER_API_KEY", "")
 	serviceBURL := getEnv("SERVICE_B_URL", "http://localhost:8081")
 	zipkinURL := getEnv("ZIPKIN_URL", "http://localhost:9411")
+	viaCEPURL := getEnv("VIACEP_URL", "https://viacep.com.br")
+	brasilAPIURL := getEnv("BRASILAPI_URL", "https://brasilapi.com.br")
+	openCEPURL := getEnv("OPENCEP_URL", "https://opencep.com")
+	postmonURL := getEnv("POSTMON_URL", "https://api.postmon.com.br")
+	requestTimeout := getEnvDuration("REQUEST_TIMEOUT", 10*time.Second)
+	locationBudgetRatio := getEnvFloat("LOCATION_BUDGET_RATIO", 0.4)
+	defaultWeatherProvider := "openmeteo"
+	if weatherAPIKey != "" {
+		defaultWeatherProvider = "weatherapi"
+	}
+	weatherProviders := getEnvList("WEATHER_PROVIDER", []string{defaultWeatherProvider})
+	weatherMode := strings.ToLower(getEnv("WEATHER_MODE", "failover"))
+	weatherProviderTimeout := time.Duration(getEnvInt("WEATHER_PROVIDER_TIMEOUT", 5000)) * time.Millisecond
+	weatherAPIURL := getEnv("WEATHER_API_URL", "https://api.weatherapi.com")
+	openMeteoURL := getEnv("OPEN_METEO_URL", "https://api.open-meteo.com")
+	weatherCacheTTL := getEnvDuration("WEATHER_CACHE_TTL", 10*time.Minute)
+	weatherCacheStaleTTL := getEnvDuration("WEATHER_CACHE_STALE_TTL", 30*time.Minute)
+	weatherCacheMaxEntries := getEnvInt("WEATHER_CACHE_MAX_ENTRIES", 10000)
+	cacheBackend := strings.ToLower(getEnv("CACHE_BACKEND", "memory"))
+	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
+	redisPassword := getEnv("REDIS_PASSWORD", "")
+	redisDB := getEnvInt("REDIS_DB", 0)
+	redisKeyPrefix := getEnv("REDIS_KEY_PREFIX", "weather-getter:")
+	locationProviders := getEnvList("LOCATION_PROVIDERS", []string{"viacep", "brasilapi", "opencep", "postmon"})
+	cepCacheTTL := getEnvDuration("CEP_CACHE_TTL", 24*time.Hour)
+	cepCacheNegativeTTL := getEnvDuration("CEP_CACHE_NEGATIVE_TTL", 10*time.Minute)
+	cepCacheMaxEntries := getEnvInt("CEP_CACHE_MAX_ENTRIES", 10000)
+	locationHedge := getEnvBool("LOCATION_HEDGE", false)
+	locationHedgePercentile := getEnvFraction("LOCATION_HEDGE_PERCENTILE", 0.95)
+	locationHedgeDelay := getEnvDuration("LOCATION_HEDGE_DELAY", 300*time.Millisecond)
+	locationHedgeTarget := strings.ToLower(getEnv("LOCATION_HEDGE_TARGET", "next"))
+	retry := getRetryPolicy("", RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  100 * time.Millisecond,
+		MaxBackoff:      2 * time.Second,
+		Jitter:          0.5,
+		RetryableStatus: []int{429, 502, 503, 504},
+		Timeout:         30 * time.Second,
+	})
+	retryPolicies := map[string]RetryPolicy{}
+	for _, upstream := range RetryUpstreams {
+		defaults := retry
+		if upstream == "service-b" {
+			// Service B answers 503 when it sheds load (open circuit or full
+			// bulkhead); retrying would only add to it.
+			defaults.RetryableStatus = slices.DeleteFunc(slices.Clone(retry.RetryableStatus), func(code int) bool {
+				return code == http.StatusServiceUnavailable
+			})
+		}
+		retryPolicies[upstream] = getRetryPolicy(upstreamEnvPrefix(upstream), defaults)
+	}
+	circuitBreaker := getCircuitBreakerPolicy("", CircuitBreakerPolicy{
+		Enabled:      true,
+		FailureRatio: 0.5,
+		MinRequests:  10,
+		Window:       30 * time.Second,
+		Cooldown:     15 * time.Second,
+	})
+	circuitBreakers := map[string]CircuitBreakerPolicy{}
+	for _, upstream := range CircuitBreakerUpstreams {
+		circuitBreakers[upstream] = getCircuitBreakerPolicy(upstreamEnvPrefix(upstream), circuitBreaker)
+	}
+	bulkhead := getBulkheadPolicy("", BulkheadPolicy{
+		Enabled:       true,
+		MaxConcurrent: 20,
+		MaxQueue:      50,
+	})
+	bulkheads := map[string]BulkheadPolicy{}
+	for _, upstream := range BulkheadUpstreams {
+		bulkheads[upstream] = getBulkheadPolicy(upstreamEnvPrefix(upstream), bulkhead)
+	}
+	logExporters := getEnvList("LOG_EXPORTER", []string{"none"})
+	logLevelOverrides := getEnvMap("LOG_LEVEL_COMPONENTS")
+	adminToken := getEnv("ADMIN_TOKEN", "")
+	traceExporters := getEnvList("TRACE_EXPORTER", []string{"zipkin"})
+	otlpEndpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	otlpTracesEndpoint := getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	otlpMetricsEndpoint := getEnv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+	otlpLogsEndpoint := getEnv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "")
+	otlpHeaders := getEnvMap("OTEL_EXPORTER_OTLP_HEADERS")
+	otlpInsecure := getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", false)
+	traceSampler := getEnv("OTEL_TRACES_SAMPLER", "parentbased_always_on")
+	traceSamplerArg := getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1.0)
+	traceSampleErrors := getEnvBool("TRACE_SAMPLE_ERRORS", true)
+	traceSampleCEPPrefixes := getEnvList("TRACE_SAMPLE_CEP_PREFIXES", nil)
+	metricsExporters := getEnvList("METRICS_EXPORTER", []string{"prometheus"})
+	metricsExportInterval := time.Duration(getEnvInt("OTEL_METRIC_EXPORT_INTERVAL", 60000)) * time.Millisecond
 
 	return Config{
 		Port:          port,
 		LogLevel:      logLevel,
 		LogJSON:       logJSON,
+		LogSource:     logSource,
 		WeatherAPIKey: weatherAPIKey,
 		ServiceBURL:   serviceBURL,
 		ZipkinURL:     zipkinURL,
+		ViaCEPURL:     viaCEPURL,
+		BrasilAPIURL:  brasilAPIURL,
+		OpenCEPURL:    openCEPURL,
+		PostmonURL:    postmonURL,
+
+		RequestTimeout:      requestTimeout,
+		LocationBudgetRatio: locationBudgetRatio,
+
+		WeatherProviders:       weatherProviders,
+		WeatherMode:            weatherMode,
+		WeatherProviderTimeout: weatherProviderTimeout,
+		WeatherAPIURL:          weatherAPIURL,
+		OpenMeteoURL:           openMeteoURL,
+		WeatherCacheTTL:        weatherCacheTTL,
+		WeatherCacheStaleTTL:   weatherCacheStaleTTL,
+		WeatherCacheMaxEntries: weatherCacheMaxEntries,
+
+		CacheBackend:   cacheBackend,
+		RedisAddr:      redisAddr,
+		RedisPassword:  redisPassword,
+		RedisDB:        redisDB,
+		RedisKeyPrefix: redisKeyPrefix,
+
+		LocationProviders:       locationProviders,
+		CEPCacheTTL:             cepCacheTTL,
+		CEPCacheNegativeTTL:     cepCacheNegativeTTL,
+		CEPCacheMaxEntries:      cepCacheMaxEntries,
+		LocationHedge:           locationHedge,
+		LocationHedgePercentile: locationHedgePercentile,
+		LocationHedgeDelay:      locationHedgeDelay,
+		LocationHedgeTarget:     locationHedgeTarget,
+
+		Retry:         retry,
+		RetryPolicies: retryPolicies,
+
+		CircuitBreaker:  circuitBreaker,
+		CircuitBreakers: circuitBreakers,
+
+		Bulkhead:  bulkhead,
+		Bulkheads: bulkheads,
+
+		LogExporters:      logExporters,
+		LogLevelOverrides: logLevelOverrides,
+		AdminToken:        adminToken,
+
+		TraceExporters:      traceExporters,
+		OTLPEndpoint:        otlpEndpoint,
+		OTLPTracesEndpoint:  otlpTracesEndpoint,
+		OTLPMetricsEndpoint: otlpMetricsEndpoint,
+		OTLPLogsEndpoint:    otlpLogsEndpoint,
+		OTLPHeaders:         otlpHeaders,
+		OTLPInsecure:        otlpInsecure,
+
+		TraceSampler:           traceSampler,
+		TraceSamplerArg:        traceSamplerArg,
+		TraceSampleErrors:      traceSampleErrors,
+		TraceSampleCEPPrefixes: traceSampleCEPPrefixes,
+
+		MetricsExporters:      metricsExporters,
+		MetricsExportInterval: metricsExportInterval,
+	}
+}
+
+var (
+	// RetryUpstreams are the upstreams whose retry policy can be overridden
+	// with <UPSTREAM>_RETRY_* variables, e.g. WEATHERAPI_RETRY_MAX_ATTEMPTS.
+	RetryUpstreams = []string{"viacep", "brasilapi", "opencep", "postmon", "weatherapi", "openmeteo", "service-b"}
+	// CircuitBreakerUpstreams are the upstreams service B guards with a
+	// circuit breaker, configurable with <UPSTREAM>_CIRCUIT_BREAKER_*.
+	CircuitBreakerUpstreams = []string{"viacep", "brasilapi", "opencep", "postmon", "weatherapi", "openmeteo"}
+	// BulkheadUpstreams are the upstreams service B guards with a bulkhead,
+	// configurable with <UPSTREAM>_BULKHEAD_*.
+	BulkheadUpstreams = []string{"viacep", "brasilapi", "opencep", "postmon", "weatherapi", "openmeteo"}
+)
+
+// RetryPolicyFor returns the retry policy of upstream, falling back to the
+// RETRY_* defaults.
+func (c Config) RetryPolicyFor(upstream string) RetryPolicy {
+	if policy, ok := c.RetryPolicies[upstream]; ok {
+		return policy
+	}
+	return c.Retry
+}
+
+// CircuitBreakerPolicyFor returns the circuit breaker policy of upstream,
+// falling back to the CIRCUIT_BREAKER_* defaults.
+func (c Config) CircuitBreakerPolicyFor(upstream string) CircuitBreakerPolicy {
+	if policy, ok := c.CircuitBreakers[upstream]; ok {
+		return policy
+	}
+	return c.CircuitBreaker
+}
+
+// BulkheadPolicyFor returns the bulkhead policy of upstream, falling back
+// to the BULKHEAD_* defaults.
+func (c Config) BulkheadPolicyFor(upstream string) BulkheadPolicy {
+	if policy, ok := c.Bulkheads[upstream]; ok {
+		return policy
+	}
+	return c.Bulkhead
+}
+
+func getBulkheadPolicy(prefix string, defaults BulkheadPolicy) BulkheadPolicy {
+	return BulkheadPolicy{
+		Enabled:       getEnvBool(prefix+"BULKHEAD_ENABLED", defaults.Enabled),
+		MaxConcurrent: getEnvInt(prefix+"BULKHEAD_MAX_CONCURRENT", defaults.MaxConcurrent),
+		MaxQueue:      getEnvNonNegativeInt(prefix+"BULKHEAD_MAX_QUEUE", defaults.MaxQueue),
+	}
+}
+
+func upstreamEnvPrefix(upstream string) string {
+	return strings.ToUpper(strings.ReplaceAll(upstream, "-", "_")) + "_"
+}
+
+func getCircuitBreakerPolicy(prefix string, defaults CircuitBreakerPolicy) CircuitBreakerPolicy {
+	return CircuitBreakerPolicy{
+		Enabled:      getEnvBool(prefix+"CIRCUIT_BREAKER_ENABLED", defaults.Enabled),
+		FailureRatio: getEnvFloat(prefix+"CIRCUIT_BREAKER_FAILURE_RATIO", defaults.FailureRatio),
+		MinRequests:  getEnvInt(prefix+"CIRCUIT_BREAKER_MIN_REQUESTS", defaults.MinRequests),
+		Window:       getEnvDuration(prefix+"CIRCUIT_BREAKER_WINDOW", defaults.Window),
+		Cooldown:     getEnvDuration(prefix+"CIRCUIT_BREAKER_COOLDOWN", defaults.Cooldown),
+	}
+}
+
+func getRetryPolicy(prefix string, defaults RetryPolicy) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     getEnvInt(prefix+"RETRY_MAX_ATTEMPTS", defaults.MaxAttempts),
+		InitialBackoff:  getEnvDuration(prefix+"RETRY_INITIAL_BACKOFF", defaults.InitialBackoff),
+		MaxBackoff:      getEnvDuration(prefix+"RETRY_MAX_BACKOFF", defaults.MaxBackoff),
+		Jitter:          getEnvFloat(prefix+"RETRY_JITTER", defaults.Jitter),
+		RetryableStatus: getEnvIntList(prefix+"RETRY_STATUS_CODES", defaults.RetryableStatus),
+		Timeout:         getEnvDuration(prefix+"RETRY_TIMEOUT", defaults.Timeout),
 	}
 }
 
@@ -47,3 +333,92 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil && intValue > 0 {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvNonNegativeInt is getEnvInt for settings where 0 is meaningful,
+// such as a bulkhead without a queue.
+func getEnvNonNegativeInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil && intValue >= 0 {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFraction reads a value in (0, 1], falling back to defaultValue
+// outside that range.
+func getEnvFraction(key string, defaultValue float64) float64 {
+	if value := getEnvFloat(key, defaultValue); value > 0 && value <= 1 {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToLower(item))
+		}
+	}
+	if len(items) == 0 {
+		return defaultValue
+	}
+	return items
+}
+
+func getEnvIntList(key string, defaultValue []int) []int {
+	var values []int
+	for _, item := range getEnvList(key, nil) {
+		if value, err := strconv.Atoi(item); err == nil {
+			values = append(values, value)
+		}
+	}
+	if values == nil {
+		return defaultValue
+	}
+	return values
+}
+
+func getEnvMap(key string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return values
+}
@@ -0,0 +1,70 @@
+package shared
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderRequestBudget carries the time, in milliseconds, the caller is still
+// willing to wait for a response. It is relative rather than an absolute
+// deadline so clock skew between services does not matter.
+const HeaderRequestBudget = "X-Request-Budget-Ms"
+
+// DeadlineMiddleware gives every request a deadline: timeout, or the budget
+// the caller sent in HeaderRequestBudget when that is shorter. A zero
+// timeout only applies the caller's budget.
+func DeadlineMiddleware(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, ok := RequestBudget(r)
+		if !ok || timeout > 0 && timeout < budget {
+			budget = timeout
+		}
+		if budget == 0 && !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestBudget returns the budget sent by the caller, if any. An exhausted
+// budget is returned as zero.
+func RequestBudget(r *http.Request) (time.Duration, bool) {
+	value := r.Header.Get(HeaderRequestBudget)
+	if value == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(max(ms, 0)) * time.Millisecond, true
+}
+
+// BudgetTransport sends the time left until the request context's deadline
+// in HeaderRequestBudget. Wrapped by a RetryTransport, every attempt carries
+// the budget left at the time it is sent.
+type BudgetTransport struct {
+	base http.RoundTripper
+}
+
+func NewBudgetTransport(base http.RoundTripper) *BudgetTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &BudgetTransport{base: base}
+}
+
+func (t *BudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(HeaderRequestBudget, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 0), 10))
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeadlineMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		budget  string
+		want    time.Duration
+	}{
+		{"own timeout", 10 * time.Second, "", 10 * time.Second},
+		{"shorter caller budget", 10 * time.Second, "2000", 2 * time.Second},
+		{"longer caller budget", time.Second, "5000", time.Second},
+		{"only caller budget", 0, "3000", 3 * time.Second},
+		{"exhausted budget", time.Second, "-5", 0},
+		{"no deadline", 0, "", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := time.Duration(-1)
+			handler := DeadlineMiddleware(tt.timeout, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if deadline, ok := r.Context().Deadline(); ok {
+					got = time.Until(deadline)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/weather", nil)
+			if tt.budget != "" {
+				req.Header.Set(HeaderRequestBudget, tt.budget)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if tt.want < 0 && got != -1 || tt.want >= 0 && (got > tt.want || got < tt.want-100*time.Millisecond) {
+				t.Errorf("deadline in %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetTransport(t *testing.T) {
+	var budgets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budgets = append(budgets, r.Header.Get(HeaderRequestBudget))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: NewBudgetTransport(nil)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if budgets[0] != "" {
+		t.Errorf("budget without deadline = %q, want none", budgets[0])
+	}
+	if ms, err := strconv.Atoi(budgets[1]); err != nil || ms > 2000 || ms < 1900 {
+		t.Errorf("budget = %q, want about 2000", budgets[1])
+	}
+	if req.Header.Get(HeaderRequestBudget) != "" {
+		t.Error("original request should not be modified")
+	}
+}
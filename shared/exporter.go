@@ -0,0 +1,71 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	ExporterZipkin   = "zipkin"
+	ExporterOTLPGRPC = "otlpgrpc"
+	ExporterOTLPHTTP = "otlphttp"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+func newSpanExporters(config Config) ([]sdktrace.SpanExporter, error) {
+	var exporters []sdktrace.SpanExporter
+	for _, name := range config.TraceExporters {
+		var exporter sdktrace.SpanExporter
+		var err error
+		switch name {
+		case ExporterZipkin:
+			exporter, err = zipkin.New(config.ZipkinURL)
+		case ExporterOTLPGRPC, ExporterOTLPHTTP:
+			exporter, err = newOTLPTraceExporter(otlpProtocol(name), config)
+		case ExporterStdout:
+			exporter, err = newStdoutExporter(os.Stdout)
+		case ExporterNone:
+			continue
+		default:
+			err = fmt.Errorf("unknown trace exporter %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s exporter: %w", name, err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
+
+// newOTLPTraceExporter returns the OpenTelemetry OTLP exporter for protocol,
+// pointed at the traces endpoint resolved from config.
+func newOTLPTraceExporter(protocol string, config Config) (sdktrace.SpanExporter, error) {
+	endpoint, err := otlpSignalURL(protocol, otlpTraces, config.OTLPEndpoint, config.OTLPTracesEndpoint, config.OTLPInsecure)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == otlpProtocolGRPC {
+		return otlptracegrpc.New(context.Background(),
+			otlptracegrpc.WithEndpointURL(endpoint),
+			otlptracegrpc.WithHeaders(config.OTLPHeaders),
+		)
+	}
+	return otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(endpoint),
+		otlptracehttp.WithHeaders(config.OTLPHeaders),
+	)
+}
+
+// newStdoutExporter writes spans to w as JSON, one object per line.
+func newStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
@@ -0,0 +1,265 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func recordTestSpans(t *testing.T) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	res, err := NewResource("service-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder), sdktrace.WithResource(res))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	child.End()
+	parent.End()
+	return recorder.Ended()
+}
+
+func TestNewSpanExporters(t *testing.T) {
+	tests := []struct {
+		name      string
+		exporters []string
+		expected  int
+		wantErr   bool
+	}{
+		{"default zipkin", []string{"zipkin"}, 1, false},
+		{"none", []string{"none"}, 0, false},
+		{"several", []string{"zipkin", "otlpgrpc", "otlphttp", "stdout"}, 4, false},
+		{"unknown", []string{"jaeger"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{ZipkinURL: "http://localhost:9411/api/v2/spans", TraceExporters: tt.exporters}
+			exporters, err := newSpanExporters(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSpanExporters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(exporters) != tt.expected {
+				t.Errorf("got %d exporters, want %d", len(exporters), tt.expected)
+			}
+		})
+	}
+}
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("path = %s, want /v1/traces", r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("content type = %s, want application/x-protobuf", r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("X-Api-Key") != "secret" {
+			t.Errorf("X-Api-Key header = %s, want secret", r.Header.Get("X-Api-Key"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		request := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("payload is not an ExportTraceServiceRequest: %v", err)
+		}
+		requests <- request
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer server.Close()
+
+	exporter, err := newOTLPTraceExporter(otlpProtocolHTTP, Config{
+		OTLPEndpoint: server.URL,
+		OTLPHeaders:  map[string]string{"X-Api-Key": "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := recordTestSpans(t)
+	if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+	assertExportedSpans(t, <-requests, spans)
+}
+
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	err      error
+	requests chan *coltracepb.ExportTraceServiceRequest
+}
+
+func (s *traceService) Export(ctx context.Context, request *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.requests <- request
+	return &coltracepb.ExportTraceServiceResponse{}, s.err
+}
+
+func TestOTLPGRPCExporter(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"ok", nil, false},
+		{"rejected", status.Error(codes.InvalidArgument, "bad payload"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			service := &traceService{err: tt.err, requests: make(chan *coltracepb.ExportTraceServiceRequest, 1)}
+			server := grpc.NewServer()
+			coltracepb.RegisterTraceServiceServer(server, service)
+			go server.Serve(listener)
+			defer server.Stop()
+
+			exporter, err := newOTLPTraceExporter(otlpProtocolGRPC, Config{OTLPEndpoint: listener.Addr().String(), OTLPInsecure: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporter.Shutdown(context.Background())
+			spans := recordTestSpans(t)
+			err = exporter.ExportSpans(context.Background(), spans)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExportSpans() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assertExportedSpans(t, <-service.requests, spans)
+		})
+	}
+}
+
+// assertExportedSpans checks that request, decoded with the OTLP protobuf
+// types, holds spans with their resource, ids and parent relationship.
+func assertExportedSpans(t *testing.T, request *coltracepb.ExportTraceServiceRequest, spans []sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if len(request.ResourceSpans) != 1 {
+		t.Fatalf("resource spans = %d, want 1", len(request.ResourceSpans))
+	}
+	resourceSpans := request.ResourceSpans[0]
+	serviceName := ""
+	for _, attr := range resourceSpans.Resource.Attributes {
+		if attr.Key == "service.name" {
+			serviceName = attr.Value.GetStringValue()
+		}
+	}
+	if serviceName != "service-test" {
+		t.Errorf("service.name = %q, want service-test", serviceName)
+	}
+	exported := map[string]*tracepb.Span{}
+	for _, scopeSpans := range resourceSpans.ScopeSpans {
+		for _, span := range scopeSpans.Spans {
+			exported[span.Name] = span
+		}
+	}
+	for _, span := range spans {
+		got, ok := exported[span.Name()]
+		if !ok {
+			t.Errorf("span %q not exported", span.Name())
+			continue
+		}
+		traceID := span.SpanContext().TraceID()
+		spanID := span.SpanContext().SpanID()
+		if !bytes.Equal(got.TraceId, traceID[:]) || !bytes.Equal(got.SpanId, spanID[:]) {
+			t.Errorf("span %q ids = %x/%x, want %s/%s", span.Name(), got.TraceId, got.SpanId, traceID, spanID)
+		}
+		if got.StartTimeUnixNano != uint64(span.StartTime().UnixNano()) {
+			t.Errorf("span %q start = %d, want %d", span.Name(), got.StartTimeUnixNano, span.StartTime().UnixNano())
+		}
+	}
+	parentID := exported["parent"].GetSpanId()
+	if child := exported["child"]; child == nil || !bytes.Equal(child.ParentSpanId, parentID) {
+		t.Errorf("child parent span id = %x, want %x", child.GetParentSpanId(), parentID)
+	}
+}
+
+func TestOTLPSignalURL(t *testing.T) {
+	tests := []struct {
+		name           string
+		protocol       string
+		endpoint       string
+		signalEndpoint string
+		insecure       bool
+		expected       string
+	}{
+		{"grpc default", otlpProtocolGRPC, "", "", false, "http://localhost:4317"},
+		{"http default", otlpProtocolHTTP, "", "", false, "http://localhost:4318/v1/traces"},
+		{"generic endpoint", otlpProtocolHTTP, "https://collector:4318", "", false, "https://collector:4318/v1/traces"},
+		{"insecure host", otlpProtocolGRPC, "collector:4317", "", true, "http://collector:4317"},
+		{"signal endpoint", otlpProtocolHTTP, "collector:4318", "https://traces.example.com/otlp/spans", false, "https://traces.example.com/otlp/spans"},
+		{"signal endpoint without path", otlpProtocolHTTP, "", "traces:4318", true, "http://traces:4318/v1/traces"},
+		{"grpc signal endpoint", otlpProtocolGRPC, "collector:4317", "https://traces:4317", false, "https://traces:4317"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := otlpSignalURL(tt.protocol, otlpTraces, tt.endpoint, tt.signalEndpoint, tt.insecure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("otlpSignalURL() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter, err := newStdoutExporter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := recordTestSpans(t)
+	if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(&buf)
+	var names []string
+	for decoder.More() {
+		var entry struct {
+			Name        string
+			SpanContext struct{ TraceID, SpanID string }
+			Resource    []struct {
+				Key   string
+				Value struct{ Value interface{} }
+			}
+		}
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		service := ""
+		for _, attr := range entry.Resource {
+			if attr.Key == "service.name" {
+				service, _ = attr.Value.Value.(string)
+			}
+		}
+		if service != "service-test" {
+			t.Errorf("service.name = %q, want service-test", service)
+		}
+		if entry.SpanContext.TraceID != spans[0].SpanContext().TraceID().String() {
+			t.Errorf("trace id = %s, want %s", entry.SpanContext.TraceID, spans[0].SpanContext().TraceID())
+		}
+		names = append(names, entry.Name)
+	}
+	if len(names) != 2 || names[0] != "child" || names[1] != "parent" {
+		t.Errorf("span names = %v, want [child parent]", names)
+	}
+}
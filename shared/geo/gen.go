@@ -0,0 +1,120 @@
+//go:build ignore
+
+// gen.go rebuilds municipios.csv from the full IBGE municipality list, as
+// published with coordinates and timezones by kelvins/municipios-brasileiros.
+//
+//	go generate ./shared/geo
+//	go run gen.go -source municipios-brasileiros.csv
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+const defaultSource = "https://raw.githubusercontent.com/kelvins/municipios-brasileiros/main/csv/municipios.csv"
+
+var ufByCode = map[string]string{
+	"11": "RO", "12": "AC", "13": "AM", "14": "RR", "15": "PA", "16": "AP", "17": "TO",
+	"21": "MA", "22": "PI", "23": "CE", "24": "RN", "25": "PB", "26": "PE", "27": "AL", "28": "SE", "29": "BA",
+	"31": "MG", "32": "ES", "33": "RJ", "35": "SP",
+	"41": "PR", "42": "SC", "43": "RS",
+	"50": "MS", "51": "MT", "52": "GO", "53": "DF",
+}
+
+func main() {
+	source := flag.String("source", defaultSource, "URL or path of the source CSV")
+	output := flag.String("output", "municipios.csv", "file to write")
+	expected := flag.Int("expected", 5570, "number of municipalities the source must have (0 skips the check)")
+	flag.Parse()
+
+	data, err := read(*source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer data.Close()
+	rows, err := convert(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *expected > 0 && len(rows) != *expected {
+		log.Fatalf("source has %d municipalities, want %d", len(rows), *expected)
+	}
+	if err := write(*output, rows); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d municipalities to %s", len(rows), *output)
+}
+
+func read(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: status %d", source, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func convert(r io.Reader) ([][]string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"codigo_ibge", "nome", "latitude", "longitude", "codigo_uf", "fuso_horario"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	rows := make([][]string, 0, len(records)-1)
+	for i, record := range records[1:] {
+		uf, ok := ufByCode[record[columns["codigo_uf"]]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown UF code %q", i+2, record[columns["codigo_uf"]])
+		}
+		rows = append(rows, []string{
+			record[columns["codigo_ibge"]],
+			record[columns["nome"]],
+			uf,
+			record[columns["latitude"]],
+			record[columns["longitude"]],
+			record[columns["fuso_horario"]],
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return rows, nil
+}
+
+func write(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"codigo_ibge", "nome", "uf", "latitude", "longitude", "fuso_horario"})
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
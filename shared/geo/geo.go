@@ -0,0 +1,237 @@
+// Package geo resolves Brazilian municipalities offline from the IBGE
+// municipality list embedded in municipios.csv.
+package geo
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:generate go run gen.go
+
+//go:embed municipios.csv
+var municipiosCSV string
+
+// ExpectedCount is the number of municipalities in the IBGE list (5,570
+// since 2013, counting Brasília and Fernando de Noronha).
+const ExpectedCount = 5570
+
+type Municipality struct {
+	Code      string  `json:"ibge"`
+	Name      string  `json:"name"`
+	UF        string  `json:"uf"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Timezone  string  `json:"timezone"`
+}
+
+var (
+	ErrNotFound  = errors.New("municipality not found")
+	ErrAmbiguous = errors.New("municipality name is ambiguous")
+)
+
+type index struct {
+	byCode map[string]Municipality
+	byName map[string][]Municipality
+	byUF   map[string][]Municipality
+}
+
+var dataset index
+
+func init() {
+	municipalities, err := parse(municipiosCSV)
+	if err != nil {
+		panic(fmt.Sprintf("geo: invalid embedded dataset: %v", err))
+	}
+	dataset = newIndex(municipalities)
+}
+
+func newIndex(municipalities []Municipality) index {
+	idx := index{
+		byCode: make(map[string]Municipality, len(municipalities)),
+		byName: make(map[string][]Municipality, len(municipalities)),
+		byUF:   map[string][]Municipality{},
+	}
+	for _, m := range municipalities {
+		idx.byCode[m.Code] = m
+		key := nameKey(m.Name, m.UF)
+		idx.byName[key] = append(idx.byName[key], m)
+		idx.byUF[m.UF] = append(idx.byUF[m.UF], m)
+	}
+	return idx
+}
+
+func parse(data string) ([]Municipality, error) {
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("missing header")
+	}
+	municipalities := make([]Municipality, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("line %d: expected 6 columns, got %d", i+2, len(row))
+		}
+		latitude, err := strconv.ParseFloat(row[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude: %w", i+2, err)
+		}
+		longitude, err := strconv.ParseFloat(row[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude: %w", i+2, err)
+		}
+		municipalities = append(municipalities, Municipality{
+			Code:      row[0],
+			Name:      row[1],
+			UF:        strings.ToUpper(row[2]),
+			Latitude:  latitude,
+			Longitude: longitude,
+			Timezone:  row[5],
+		})
+	}
+	return municipalities, nil
+}
+
+// ByCode returns the municipality with the given 7 digit IBGE code.
+func ByCode(code string) (Municipality, bool) {
+	return dataset.lookupCode(code)
+}
+
+// ByName returns the municipality with the given name in the given state,
+// ignoring case, accents and punctuation. It fails with ErrNotFound when no
+// municipality has that name and with ErrAmbiguous when several do.
+func ByName(name, uf string) (Municipality, error) {
+	return dataset.lookupName(name, uf)
+}
+
+// Search is like ByName but tolerates small spelling differences, such as
+// a missing letter or a "Sta." abbreviation, returning the closest
+// municipality of the state. Names that are too different fail with
+// ErrNotFound, and names equally close to several municipalities with
+// ErrAmbiguous.
+func Search(name, uf string) (Municipality, error) {
+	return dataset.search(name, uf)
+}
+
+// Count returns the number of municipalities in the embedded dataset.
+func Count() int {
+	return len(dataset.byCode)
+}
+
+func (idx index) lookupCode(code string) (Municipality, bool) {
+	m, ok := idx.byCode[strings.TrimSpace(code)]
+	return m, ok
+}
+
+func (idx index) lookupName(name, uf string) (Municipality, error) {
+	matches := idx.byName[nameKey(name, uf)]
+	switch len(matches) {
+	case 0:
+		return Municipality{}, fmt.Errorf("%w: %s/%s", ErrNotFound, name, uf)
+	case 1:
+		return matches[0], nil
+	default:
+		return Municipality{}, fmt.Errorf("%w: %s/%s matches %d municipalities", ErrAmbiguous, name, uf, len(matches))
+	}
+}
+
+func (idx index) search(name, uf string) (Municipality, error) {
+	if m, err := idx.lookupName(name, uf); !errors.Is(err, ErrNotFound) {
+		return m, err
+	}
+	query := expandAbbreviations(normalize(name))
+	if query == "" {
+		return Municipality{}, fmt.Errorf("%w: %s/%s", ErrNotFound, name, uf)
+	}
+	var best []Municipality
+	bestDistance := -1
+	for _, m := range idx.byUF[strings.ToUpper(strings.TrimSpace(uf))] {
+		switch distance := levenshtein(query, normalize(m.Name)); {
+		case bestDistance < 0 || distance < bestDistance:
+			best, bestDistance = []Municipality{m}, distance
+		case distance == bestDistance:
+			best = append(best, m)
+		}
+	}
+	switch {
+	case bestDistance < 0 || bestDistance > maxDistance(query):
+		return Municipality{}, fmt.Errorf("%w: %s/%s", ErrNotFound, name, uf)
+	case len(best) > 1:
+		return Municipality{}, fmt.Errorf("%w: %s/%s is as close to %d municipalities", ErrAmbiguous, name, uf, len(best))
+	}
+	return best[0], nil
+}
+
+func maxDistance(name string) int {
+	if n := utf8.RuneCountInString(name) / 5; n > 1 {
+		return n
+	}
+	return 1
+}
+
+func nameKey(name, uf string) string {
+	return normalize(name) + "/" + strings.ToUpper(strings.TrimSpace(uf))
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+func normalize(name string) string {
+	name = accents.Replace(strings.ToLower(name))
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+var abbreviations = map[string]string{
+	"sta": "santa",
+	"sto": "santo",
+	"s":   "sao",
+	"n":   "nossa",
+	"sra": "senhora",
+}
+
+func expandAbbreviations(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		if expanded, ok := abbreviations[word]; ok {
+			words[i] = expanded
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
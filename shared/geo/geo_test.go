@@ -0,0 +1,146 @@
+package geo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestByCode(t *testing.T) {
+	m, ok := ByCode("3203205")
+	if !ok {
+		t.Fatal("Linhares not found by code")
+	}
+	if m.Name != "Linhares" || m.UF != "ES" || m.Latitude == 0 || m.Longitude == 0 {
+		t.Errorf("municipality = %+v", m)
+	}
+	if _, ok := ByCode("0000000"); ok {
+		t.Error("unexpected municipality for unknown code")
+	}
+}
+
+func TestByName(t *testing.T) {
+	tests := []struct {
+		name string
+		city string
+		uf   string
+		code string
+		err  error
+	}{
+		{"exact", "Vitória", "ES", "3205309", nil},
+		{"without accents", "vitoria", "es", "3205309", nil},
+		{"extra spaces", "  Sao  Paulo ", "SP", "3550308", nil},
+		{"other state", "Santa Rita", "PB", "2513703", nil},
+		{"wrong state", "Vitória", "SP", "", ErrNotFound},
+		{"misspelled", "Linharez", "ES", "", ErrNotFound},
+		{"abbreviated", "Sta Rita", "PB", "", ErrNotFound},
+		{"empty", "", "ES", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ByName(tt.city, tt.uf)
+			if !errors.Is(err, tt.err) || m.Code != tt.code {
+				t.Errorf("ByName(%q, %q) = %+v, %v; want code %q, %v", tt.city, tt.uf, m, err, tt.code, tt.err)
+			}
+		})
+	}
+}
+
+func TestByNameAmbiguous(t *testing.T) {
+	idx := newIndex([]Municipality{
+		{Code: "1", Name: "São Domingos", UF: "GO"},
+		{Code: "2", Name: "Sao Domingos", UF: "GO"},
+		{Code: "3", Name: "São Domingos", UF: "SC"},
+	})
+	if _, err := idx.lookupName("São Domingos", "GO"); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("lookupName() error = %v, want ErrAmbiguous", err)
+	}
+	if m, err := idx.lookupName("São Domingos", "SC"); err != nil || m.Code != "3" {
+		t.Errorf("lookupName() = %+v, %v; want code 3", m, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name string
+		city string
+		uf   string
+		code string
+		err  error
+	}{
+		{"exact", "Linhares", "ES", "3203205", nil},
+		{"typo", "Linharez", "ES", "3203205", nil},
+		{"missing letter", "Florianopols", "SC", "4205407", nil},
+		{"abbreviation", "Sta Rita", "PB", "2513703", nil},
+		{"abbreviated sao", "S. Paulo", "SP", "3550308", nil},
+		{"too different", "Campinas", "ES", "", ErrNotFound},
+		{"unknown state", "Linhares", "XX", "", ErrNotFound},
+		{"empty", "", "ES", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Search(tt.city, tt.uf)
+			if !errors.Is(err, tt.err) || m.Code != tt.code {
+				t.Errorf("Search(%q, %q) = %+v, %v; want code %q, %v", tt.city, tt.uf, m, err, tt.code, tt.err)
+			}
+		})
+	}
+}
+
+func TestSearchAmbiguous(t *testing.T) {
+	idx := newIndex([]Municipality{
+		{Code: "1", Name: "Itapira", UF: "SP"},
+		{Code: "2", Name: "Itapura", UF: "SP"},
+	})
+	if _, err := idx.search("Itapara", "SP"); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("search() error = %v, want ErrAmbiguous", err)
+	}
+	if m, err := idx.search("Itapiru", "SP"); err != nil || m.Code != "1" {
+		t.Errorf("search() = %+v, %v; want code 1", m, err)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	for code, timezone := range map[string]string{
+		"3550308": "America/Sao_Paulo",
+		"1302603": "America/Manaus",
+		"1200401": "America/Rio_Branco",
+	} {
+		if m, _ := ByCode(code); m.Timezone != timezone {
+			t.Errorf("ByCode(%s).Timezone = %q, want %q", code, m.Timezone, timezone)
+		}
+	}
+}
+
+func TestDataset(t *testing.T) {
+	municipalities, err := parse(municipiosCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefixes := map[string]string{}
+	for _, m := range municipalities {
+		if len(m.Code) != 7 {
+			t.Errorf("%s/%s: code %q should have 7 digits", m.Name, m.UF, m.Code)
+			continue
+		}
+		if uf, ok := prefixes[m.Code[:2]]; ok && uf != m.UF {
+			t.Errorf("%s: UF %s, but code prefix %s belongs to %s", m.Code, m.UF, m.Code[:2], uf)
+		}
+		prefixes[m.Code[:2]] = m.UF
+		if m.Latitude < -34 || m.Latitude > 6 || m.Longitude < -74 || m.Longitude > -28 {
+			t.Errorf("%s: coordinates %v,%v outside Brazil", m.Code, m.Latitude, m.Longitude)
+		}
+		if !strings.HasPrefix(m.Timezone, "America/") {
+			t.Errorf("%s: timezone %q", m.Code, m.Timezone)
+		}
+	}
+	if Count() != len(municipalities) {
+		t.Errorf("Count() = %d, want %d unique codes", Count(), len(municipalities))
+	}
+}
+
+func TestDatasetCount(t *testing.T) {
+	if Count() != ExpectedCount {
+		t.Errorf("municipios.csv has %d municipalities, want the %d of the IBGE list; run go generate ./shared/geo", Count(), ExpectedCount)
+	}
+}
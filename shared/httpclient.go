@@ -0,0 +1,105 @@
+package shared
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var sensitiveQueryParams = []string{"key", "api_key", "apikey", "token", "access_token", "password", "secret"}
+
+type TracingTransport struct {
+	base   http.RoundTripper
+	tracer trace.Tracer
+}
+
+func NewTracingTransport(base http.RoundTripper, tracer trace.Tracer) *TracingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &TracingTransport{base: base, tracer: tracer}
+}
+
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.URLFull(RedactURL(req.URL)),
+		semconv.ServerAddress(req.URL.Hostname()),
+	}
+	if port := urlPort(req.URL); port > 0 {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	if count := resendCount(req.Context()); count > 0 {
+		attrs = append(attrs, semconv.HTTPRequestResendCount(count))
+	}
+	ctx, span := t.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	req = req.Clone(ctx)
+	InjectTraceContext(ctx, req.Header)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(semconv.ErrorTypeKey.String(fmt.Sprintf("%T", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode)))
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.User != nil {
+		redacted.User = url.UserPassword("REDACTED", "REDACTED")
+	}
+	query := redacted.Query()
+	changed := false
+	for name := range query {
+		if isSensitiveQueryParam(name) {
+			query.Set(name, "REDACTED")
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+func isSensitiveQueryParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveQueryParams {
+		if name == sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+func urlPort(u *url.URL) int {
+	if port := u.Port(); port != "" {
+		p, _ := strconv.Atoi(port)
+		return p
+	}
+	switch u.Scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
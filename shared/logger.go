@@ -1,15 +1,28 @@
 package shared
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type LogLevel int
 
+// fatalFlushTimeout bounds how long Fatal waits for buffered logs to be
+// exported before the process exits.
+const fatalFlushTimeout = 2 * time.Second
+
 const (
 	DEBUG LogLevel = iota
 	INFO
@@ -17,99 +30,259 @@ const (
 	ERROR
 )
 
+type LoggerOptions struct {
+	Level     LogLevel
+	JSON      bool
+	AddSource bool
+	Writer    io.Writer
+	Handler   slog.Handler
+}
+
 type Logger struct {
-	level  LogLevel
-	json   bool
-	logger *log.Logger
+	slog     *slog.Logger
+	levels   *LevelController
+	shutdown func(timeout time.Duration)
 }
 
 func NewLogger(level LogLevel, json bool) *Logger {
+	return NewLoggerWithOptions(LoggerOptions{Level: level, JSON: json})
+}
+
+func NewLoggerWithOptions(opts LoggerOptions) *Logger {
+	return newLogger(newBaseHandler(opts), NewLevelController(opts.Level))
+}
+
+func InitLogger(serviceName string, config Config) (*Logger, func(), error) {
+	opts := LoggerOptions{
+		Level:     ParseLogLevel(config.LogLevel),
+		JSON:      config.LogJSON,
+		AddSource: config.LogSource,
+	}
+	var processors []sdklog.LoggerProviderOption
+	for _, name := range config.LogExporters {
+		switch name {
+		case ExporterOTLPGRPC, ExporterOTLPHTTP:
+			exporter, err := newOTLPLogExporter(otlpProtocol(name), config)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create %s log exporter: %w", name, err)
+			}
+			processors = append(processors, sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)))
+		case ExporterNone:
+		default:
+			return nil, nil, fmt.Errorf("unknown log exporter %q", name)
+		}
+	}
+	if len(processors) == 0 {
+		logger := NewLoggerWithOptions(opts)
+		logger.levels.SetOverrides(config.LogLevelOverrides)
+		return logger, func() {}, nil
+	}
+	res, err := NewResource(serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := sdklog.NewLoggerProvider(append(processors, sdklog.WithResource(res))...)
+	handler := &fanoutHandler{handlers: []slog.Handler{
+		newBaseHandler(opts),
+		&otlpLogHandler{logger: provider.Logger(serviceName, otellog.WithInstrumentationVersion(ServiceVersion))},
+	}}
+	levels := NewLevelController(opts.Level)
+	levels.SetOverrides(config.LogLevelOverrides)
+	var once sync.Once
+	logger := newLogger(handler, levels)
+	logger.shutdown = func(timeout time.Duration) {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			provider.Shutdown(ctx)
+		})
+	}
+	cleanup := func() {
+		logger.shutdown(5 * time.Second)
+	}
+	return logger, cleanup, nil
+}
+
+func newBaseHandler(opts LoggerOptions) slog.Handler {
+	if opts.Handler != nil {
+		return opts.Handler
+	}
+	writer := opts.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+	handlerOpts := &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		AddSource:   opts.AddSource,
+		ReplaceAttr: replaceLogAttr,
+	}
+	if opts.JSON {
+		return slog.NewJSONHandler(writer, handlerOpts)
+	}
+	return slog.NewTextHandler(writer, handlerOpts)
+}
+
+func NewLoggerWithHandler(handler slog.Handler) *Logger {
+	return newLogger(handler, NewLevelController(DEBUG))
+}
+
+func newLogger(handler slog.Handler, levels *LevelController) *Logger {
 	return &Logger{
-		level:  level,
-		json:   json,
-		logger: log.New(os.Stdout, "", log.LstdFlags),
+		slog:   slog.New(&traceHandler{Handler: &levelHandler{Handler: handler, levels: levels}}),
+		levels: levels,
 	}
 }
 
+func (l *Logger) Slog() *slog.Logger {
+	return l.slog
+}
+
+func (l *Logger) Handler() slog.Handler {
+	return l.slog.Handler()
+}
+
+func (l *Logger) Levels() *LevelController {
+	return l.levels
+}
+
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{slog: l.slog.With(args...), levels: l.levels, shutdown: l.shutdown}
+}
+
+func (l *Logger) WithGroup(name string) *Logger {
+	return &Logger{slog: l.slog.WithGroup(name), levels: l.levels, shutdown: l.shutdown}
+}
+
+func (l *Logger) Component(name string) *Logger {
+	return l.With(componentKey, name)
+}
+
 func (l *Logger) Debug(message string, fields map[string]interface{}) {
-	if l.level <= DEBUG {
-		l.log(DEBUG, message, fields)
-	}
+	l.log(context.Background(), DEBUG, message, fields)
 }
 
 func (l *Logger) Info(message string, fields map[string]interface{}) {
-	if l.level <= INFO {
-		l.log(INFO, message, fields)
-	}
+	l.log(context.Background(), INFO, message, fields)
 }
 
 func (l *Logger) Warn(message string, fields map[string]interface{}) {
-	if l.level <= WARN {
-		l.log(WARN, message, fields)
-	}
+	l.log(context.Background(), WARN, message, fields)
 }
 
 func (l *Logger) Error(message string, fields map[string]interface{}) {
-	if l.level <= ERROR {
-		l.log(ERROR, message, fields)
-	}
+	l.log(context.Background(), ERROR, message, fields)
 }
 
 func (l *Logger) Fatal(message string, fields map[string]interface{}) {
-	l.log(ERROR, message, fields)
+	l.log(context.Background(), ERROR, message, fields)
+	if l.shutdown != nil {
+		l.shutdown(fatalFlushTimeout)
+	}
 	os.Exit(1)
 }
 
-func (l *Logger) log(level LogLevel, message string, fields map[string]interface{}) {
-	if l.json {
-		l.logJSON(level, message, fields)
-	} else {
-		l.logText(level, message, fields)
-	}
+func (l *Logger) DebugCtx(ctx context.Context, message string, fields map[string]interface{}) {
+	l.log(ctx, DEBUG, message, fields)
 }
 
-func (l *Logger) logJSON(level LogLevel, message string, fields map[string]interface{}) {
-	logEntry := map[string]interface{}{
-		"timestamp": time.Now().Format(time.RFC3339),
-		"level":     l.levelString(level),
-		"message":   message,
-	}
+func (l *Logger) InfoCtx(ctx context.Context, message string, fields map[string]interface{}) {
+	l.log(ctx, INFO, message, fields)
+}
 
-	for key, value := range fields {
-		logEntry[key] = value
-	}
+func (l *Logger) WarnCtx(ctx context.Context, message string, fields map[string]interface{}) {
+	l.log(ctx, WARN, message, fields)
+}
 
-	jsonData, err := json.Marshal(logEntry)
-	if err != nil {
-		l.logger.Printf("Error marshaling log entry: %v", err)
+func (l *Logger) ErrorCtx(ctx context.Context, message string, fields map[string]interface{}) {
+	l.log(ctx, ERROR, message, fields)
+}
+
+func (l *Logger) log(ctx context.Context, level LogLevel, message string, fields map[string]interface{}) {
+	handler := l.slog.Handler()
+	if !handler.Enabled(ctx, level.slogLevel()) {
 		return
 	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), level.slogLevel(), message, pcs[0])
+	record.AddAttrs(fieldsToAttrs(fields)...)
+	handler.Handle(ctx, record)
+}
 
-	l.logger.Println(string(jsonData))
+func fieldsToAttrs(fields map[string]interface{}) []slog.Attr {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, fieldToAttr(key, fields[key]))
+	}
+	return attrs
 }
 
-func (l *Logger) logText(level LogLevel, message string, fields map[string]interface{}) {
-	levelStr := l.levelString(level)
-	timestamp := time.Now().Format("2006-01-02T15:04:05Z07:00")
+func fieldToAttr(key string, value interface{}) slog.Attr {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return slog.Attr{Key: key, Value: slog.GroupValue(fieldsToAttrs(v)...)}
+	case error:
+		return slog.String(key, v.Error())
+	default:
+		return slog.Any(key, v)
+	}
+}
 
-	logMsg := fmt.Sprintf("[%s] %s: %s", timestamp, levelStr, message)
+func replaceLogAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return attr
+	}
+	switch attr.Key {
+	case slog.TimeKey:
+		attr.Key = "timestamp"
+	case slog.MessageKey:
+		attr.Key = "message"
+	}
+	return attr
+}
 
-	if len(fields) > 0 {
-		fieldsStr := ""
-		for key, value := range fields {
-			if fieldsStr != "" {
-				fieldsStr += ", "
-			}
-			fieldsStr += fmt.Sprintf("%s=%v", key, value)
-		}
-		logMsg += fmt.Sprintf(" | %s", fieldsStr)
+func ParseLogLevel(level string) LogLevel {
+	if parsed, ok := LookupLogLevel(level); ok {
+		return parsed
+	}
+	return INFO
+}
+
+func LookupLogLevel(level string) (LogLevel, bool) {
+	switch strings.ToUpper(strings.TrimSpace(level)) {
+	case "DEBUG":
+		return DEBUG, true
+	case "INFO":
+		return INFO, true
+	case "WARN":
+		return WARN, true
+	case "ERROR":
+		return ERROR, true
+	default:
+		return INFO, false
 	}
+}
 
-	l.logger.Println(logMsg)
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
 }
 
-func (l *Logger) levelString(level LogLevel) string {
-	switch level {
+func (l LogLevel) String() string {
+	switch l {
 	case DEBUG:
 		return "DEBUG"
 	case INFO:
@@ -122,3 +295,26 @@ func (l *Logger) levelString(level LogLevel) string {
 		return "UNKNOWN"
 	}
 }
+
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h *traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+			slog.String("trace_flags", sc.TraceFlags().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,88 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestLoggerTraceCorrelation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(LoggerOptions{Level: DEBUG, JSON: true, Writer: &buf})
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	logger.InfoCtx(ctx, "Requisição recebida", map[string]interface{}{"cep": "29902555"})
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["trace_id"] != span.SpanContext().TraceID().String() {
+		t.Errorf("trace_id = %v, want %s", entry["trace_id"], span.SpanContext().TraceID())
+	}
+	if entry["span_id"] != span.SpanContext().SpanID().String() {
+		t.Errorf("span_id = %v, want %s", entry["span_id"], span.SpanContext().SpanID())
+	}
+	if entry["trace_flags"] != "01" {
+		t.Errorf("trace_flags = %v, want 01", entry["trace_flags"])
+	}
+	if entry["cep"] != "29902555" {
+		t.Errorf("cep = %v, want 29902555", entry["cep"])
+	}
+
+	buf.Reset()
+	logger.InfoCtx(context.Background(), "Sem trace", nil)
+	entry = nil
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["trace_id"]; ok {
+		t.Error("trace_id should be omitted without an active span")
+	}
+}
+
+func TestLoggerTextOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(LoggerOptions{Level: INFO, Writer: &buf, AddSource: true})
+	logger.Debug("ignorado", nil)
+	logger.Info("Localização encontrada", map[string]interface{}{
+		"state": "ES",
+		"city":  "Linhares",
+		"cep":   "29902555",
+		"geo":   map[string]interface{}{"lon": -40.07, "lat": -19.39},
+	})
+	output := buf.String()
+	if strings.Contains(output, "ignorado") {
+		t.Error("debug entries should be filtered at INFO level")
+	}
+	want := `message="Localização encontrada" cep=29902555 city=Linhares geo.lat=-19.39 geo.lon=-40.07 state=ES`
+	if !strings.Contains(output, want) {
+		t.Errorf("output = %q, want it to contain %q", output, want)
+	}
+	if !strings.Contains(output, "source=") || !strings.Contains(output, "logger_test.go:") {
+		t.Errorf("output = %q, want caller source location", output)
+	}
+}
+
+func TestLoggerWithHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})
+	logger := NewLoggerWithHandler(handler).WithGroup("viacep")
+	logger.Info("ignorado", nil)
+	logger.Slog().Warn("CEP não encontrado", "cep", "99999999")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	group, ok := entry["viacep"].(map[string]interface{})
+	if !ok || group["cep"] != "99999999" {
+		t.Errorf("entry = %v, want cep grouped under viacep", entry)
+	}
+}
@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+const componentKey = "component"
+
+type LevelController struct {
+	mu        sync.RWMutex
+	level     LogLevel
+	overrides map[string]LogLevel
+}
+
+func NewLevelController(level LogLevel) *LevelController {
+	return &LevelController{level: level, overrides: map[string]LogLevel{}}
+}
+
+func (c *LevelController) Level() LogLevel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.level
+}
+
+func (c *LevelController) SetLevel(level LogLevel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.level = level
+}
+
+func (c *LevelController) SetComponentLevel(component string, level LogLevel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overrides[component] = level
+}
+
+func (c *LevelController) ClearComponentLevel(component string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.overrides, component)
+}
+
+func (c *LevelController) SetOverrides(overrides map[string]string) {
+	parsed := map[string]LogLevel{}
+	for component, value := range overrides {
+		if level, ok := LookupLogLevel(value); ok {
+			parsed[component] = level
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overrides = parsed
+}
+
+func (c *LevelController) ComponentLevels() map[string]LogLevel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	levels := make(map[string]LogLevel, len(c.overrides))
+	for component, level := range c.overrides {
+		levels[component] = level
+	}
+	return levels
+}
+
+func (c *LevelController) Enabled(component string, level slog.Level) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	effective := c.level
+	if override, ok := c.overrides[component]; ok && component != "" {
+		effective = override
+	}
+	return level >= effective.slogLevel()
+}
+
+type levelHandler struct {
+	slog.Handler
+	levels    *LevelController
+	component string
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.levels.Enabled(h.component, level) && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, attr := range attrs {
+		if attr.Key == componentKey {
+			component = attr.Value.String()
+		}
+	}
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), levels: h.levels, component: component}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), levels: h.levels, component: h.component}
+}
+
+type logLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+type logLevelResponse struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+// LogLevelHandler serves /admin/loglevel. Without a token the endpoint is
+// disabled and answers 404.
+func LogLevelHandler(logger *Logger, token string) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if token == "" {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Message: "not found"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Message: "unauthorized"})
+			return
+		}
+		levels := logger.Levels()
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Message: "invalid request body"})
+				return
+			}
+			var request logLevelRequest
+			if err := json.Unmarshal(body, &request); err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Message: "invalid json format"})
+				return
+			}
+			if request.Component != "" && request.Level == "" {
+				levels.ClearComponentLevel(request.Component)
+				logger.InfoCtx(r.Context(), "Nível de log do componente removido", map[string]interface{}{
+					"target_component": request.Component,
+				})
+				break
+			}
+			level, ok := LookupLogLevel(request.Level)
+			if !ok {
+				writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse{Message: "invalid log level"})
+				return
+			}
+			if request.Component != "" {
+				levels.SetComponentLevel(request.Component, level)
+			} else {
+				levels.SetLevel(level)
+			}
+			logger.InfoCtx(r.Context(), "Nível de log alterado", map[string]interface{}{
+				"level":            level.String(),
+				"target_component": request.Component,
+			})
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Message: "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, currentLogLevels(levels))
+	})
+}
+
+func currentLogLevels(levels *LevelController) logLevelResponse {
+	response := logLevelResponse{Level: levels.Level().String(), Components: map[string]string{}}
+	components := levels.ComponentLevels()
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		response.Components[name] = components[name].String()
+	}
+	return response
+}
+
+func ReloadLogLevelOnSIGHUP(logger *Logger, load func() Config) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				config := load()
+				logger.Levels().SetLevel(ParseLogLevel(config.LogLevel))
+				logger.Levels().SetOverrides(config.LogLevelOverrides)
+				logger.Info("Nível de log recarregado", map[string]interface{}{
+					"level":      config.LogLevel,
+					"components": config.LogLevelOverrides,
+				})
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
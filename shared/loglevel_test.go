@@ -0,0 +1,107 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevelControllerComponentOverrides(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(LoggerOptions{Level: INFO, Writer: &buf})
+	weather := logger.Component("weatherapi")
+
+	weather.Debug("antes do override", nil)
+	logger.Levels().SetComponentLevel("weatherapi", DEBUG)
+	weather.Debug("depois do override", nil)
+	logger.Debug("root debug", nil)
+	logger.Levels().SetLevel(ERROR)
+	logger.Info("root info", nil)
+	weather.Info("weather info", nil)
+
+	output := buf.String()
+	if strings.Contains(output, "antes do override") || strings.Contains(output, "root debug") || strings.Contains(output, "root info") {
+		t.Errorf("output should not contain filtered entries:\n%s", output)
+	}
+	if !strings.Contains(output, "depois do override") || !strings.Contains(output, "weather info") {
+		t.Errorf("output should contain weatherapi entries:\n%s", output)
+	}
+	if !strings.Contains(output, "component=weatherapi") {
+		t.Errorf("output should include the component attribute:\n%s", output)
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	logger := NewLoggerWithOptions(LoggerOptions{Level: INFO, Writer: &bytes.Buffer{}})
+	handler := LogLevelHandler(logger, "secret")
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		token      string
+		statusCode int
+		level      string
+		components map[string]string
+	}{
+		{"unauthorized", http.MethodPut, `{"level":"DEBUG"}`, "", http.StatusUnauthorized, "", nil},
+		{"wrong token", http.MethodGet, "", "secrets", http.StatusUnauthorized, "", nil},
+		{"get", http.MethodGet, "", "secret", http.StatusOK, "INFO", map[string]string{}},
+		{"set global", http.MethodPut, `{"level":"warn"}`, "secret", http.StatusOK, "WARN", map[string]string{}},
+		{"set component", http.MethodPut, `{"component":"weatherapi","level":"DEBUG"}`, "secret", http.StatusOK, "WARN", map[string]string{"weatherapi": "DEBUG"}},
+		{"invalid level", http.MethodPut, `{"level":"TRACE"}`, "secret", http.StatusUnprocessableEntity, "", nil},
+		{"clear component", http.MethodPut, `{"component":"weatherapi"}`, "secret", http.StatusOK, "WARN", map[string]string{}},
+		{"method not allowed", http.MethodPost, `{}`, "secret", http.StatusMethodNotAllowed, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/loglevel", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.statusCode, rec.Body.String())
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var response logLevelResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Level != tt.level {
+				t.Errorf("level = %s, want %s", response.Level, tt.level)
+			}
+			if len(response.Components) != len(tt.components) {
+				t.Errorf("components = %v, want %v", response.Components, tt.components)
+			}
+			for component, level := range tt.components {
+				if response.Components[component] != level {
+					t.Errorf("components[%s] = %s, want %s", component, response.Components[component], level)
+				}
+			}
+		})
+	}
+}
+
+func TestLogLevelHandlerDisabledWithoutToken(t *testing.T) {
+	logger := NewLoggerWithOptions(LoggerOptions{Level: INFO, Writer: &bytes.Buffer{}})
+	handler := LogLevelHandler(logger, "")
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(`{"level":"DEBUG"}`))
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 without ADMIN_TOKEN", rec.Code)
+	}
+	if logger.Levels().Level() != INFO {
+		t.Errorf("level = %s, want INFO to stay unchanged", logger.Levels().Level())
+	}
+}
@@ -0,0 +1,305 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	MetricsExporterPrometheus = "prometheus"
+)
+
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Meter records the services' metrics through the OpenTelemetry metric SDK.
+// The Prometheus registry is nil when the prometheus exporter is disabled.
+type Meter struct {
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+	registry *prometheus.Registry
+
+	requestCount     metric.Float64Counter
+	requestDuration  metric.Float64Histogram
+	upstreamDuration metric.Float64Histogram
+	errorCount       metric.Float64Counter
+	cacheRequests    metric.Float64Counter
+	circuitState     metric.Float64Gauge
+	circuitRejected  metric.Float64Counter
+	bulkheadQueue    metric.Float64Gauge
+	bulkheadRejected metric.Float64Counter
+}
+
+func InitMeter(serviceName string, config Config) (*Meter, func(), error) {
+	res, err := NewResource(serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var registry *prometheus.Registry
+	var readers []sdkmetric.Reader
+	var exporters []*countingMetricExporter
+	for _, name := range config.MetricsExporters {
+		switch name {
+		case MetricsExporterPrometheus:
+			if registry != nil {
+				continue
+			}
+			registry = prometheus.NewRegistry()
+			reader, err := newPrometheusReader(registry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create %s metrics exporter: %w", name, err)
+			}
+			readers = append(readers, reader)
+		case ExporterOTLPGRPC, ExporterOTLPHTTP:
+			exporter, err := newOTLPMetricExporter(otlpProtocol(name), config)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create %s metrics exporter: %w", name, err)
+			}
+			counting := &countingMetricExporter{Exporter: exporter}
+			exporters = append(exporters, counting)
+			readers = append(readers, sdkmetric.NewPeriodicReader(counting, sdkmetric.WithInterval(config.MetricsExportInterval)))
+		case ExporterNone:
+		default:
+			return nil, nil, fmt.Errorf("unknown metrics exporter %q", name)
+		}
+	}
+	meter := newMeter(res, serviceName, registry, readers...)
+	for _, exporter := range exporters {
+		exporter.meter = meter
+	}
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := meter.provider.Shutdown(ctx); err != nil {
+			otel.Handle(err)
+		}
+	}
+	return meter, cleanup, nil
+}
+
+// NewMeter returns a Meter that is only read through its Prometheus handler.
+func NewMeter(res *resource.Resource, scopeName string) *Meter {
+	registry := prometheus.NewRegistry()
+	reader, err := newPrometheusReader(registry)
+	if err != nil {
+		otel.Handle(err)
+		return newMeter(res, scopeName, nil)
+	}
+	return newMeter(res, scopeName, registry, reader)
+}
+
+func newMeter(res *resource.Resource, scopeName string, registry *prometheus.Registry, readers ...sdkmetric.Reader) *Meter {
+	options := []sdkmetric.Option{}
+	if res != nil {
+		options = append(options, sdkmetric.WithResource(res))
+	}
+	for _, reader := range readers {
+		options = append(options, sdkmetric.WithReader(reader))
+	}
+	provider := sdkmetric.NewMeterProvider(options...)
+	m := &Meter{
+		provider: provider,
+		meter:    provider.Meter(scopeName, metric.WithInstrumentationVersion(ServiceVersion)),
+		registry: registry,
+	}
+	m.requestCount = m.NewCounter("http_server_requests_total", "Total number of HTTP requests received")
+	m.requestDuration = m.NewHistogram("http_server_request_duration_seconds", "Latency of HTTP requests received", "s", DefaultDurationBuckets)
+	m.upstreamDuration = m.NewHistogram("upstream_request_duration_seconds", "Latency of calls to upstream dependencies", "s", DefaultDurationBuckets)
+	m.errorCount = m.NewCounter("errors_total", "Total number of errors by category")
+	m.cacheRequests = m.NewCounter("cache_requests_total", "Total number of cache lookups by cache and result")
+	m.circuitState = m.NewGauge("circuit_breaker_state", "Circuit breaker state per upstream (0 closed, 1 half-open, 2 open)")
+	m.circuitRejected = m.NewCounter("circuit_breaker_rejections_total", "Total number of calls rejected by an open circuit breaker")
+	m.bulkheadQueue = m.NewGauge("bulkhead_queue_depth", "Calls waiting for a free concurrency slot per upstream")
+	m.bulkheadRejected = m.NewCounter("bulkhead_rejections_total", "Total number of calls rejected by a full bulkhead")
+	return m
+}
+
+func newPrometheusReader(registry *prometheus.Registry) (sdkmetric.Reader, error) {
+	return otelprometheus.New(
+		otelprometheus.WithRegisterer(registry),
+		otelprometheus.WithoutScopeInfo(),
+		otelprometheus.WithoutTargetInfo(),
+	)
+}
+
+// newOTLPMetricExporter returns the OpenTelemetry OTLP exporter for protocol,
+// pointed at the metrics endpoint resolved from config.
+func newOTLPMetricExporter(protocol string, config Config) (sdkmetric.Exporter, error) {
+	endpoint, err := otlpSignalURL(protocol, otlpMetrics, config.OTLPEndpoint, config.OTLPMetricsEndpoint, config.OTLPInsecure)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == otlpProtocolGRPC {
+		return otlpmetricgrpc.New(context.Background(),
+			otlpmetricgrpc.WithEndpointURL(endpoint),
+			otlpmetricgrpc.WithHeaders(config.OTLPHeaders),
+		)
+	}
+	return otlpmetrichttp.New(context.Background(),
+		otlpmetrichttp.WithEndpointURL(endpoint),
+		otlpmetrichttp.WithHeaders(config.OTLPHeaders),
+	)
+}
+
+// countingMetricExporter counts failed exports in errors_total; the periodic
+// reader hands the error itself to the OpenTelemetry error handler.
+type countingMetricExporter struct {
+	sdkmetric.Exporter
+	meter *Meter
+}
+
+func (e *countingMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	if err != nil && e.meter != nil {
+		e.meter.RecordError("metrics export")
+	}
+	return err
+}
+
+func (m *Meter) NewCounter(name, help string) metric.Float64Counter {
+	counter, err := m.meter.Float64Counter(name, metric.WithDescription(help))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+}
+
+func (m *Meter) NewGauge(name, help string) metric.Float64Gauge {
+	gauge, err := m.meter.Float64Gauge(name, metric.WithDescription(help))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return gauge
+}
+
+func (m *Meter) NewHistogram(name, help, unit string, buckets []float64) metric.Float64Histogram {
+	histogram, err := m.meter.Float64Histogram(name,
+		metric.WithDescription(help),
+		metric.WithUnit(unit),
+		metric.WithExplicitBucketBoundaries(buckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return histogram
+}
+
+func (m *Meter) RecordRequest(method, route string, statusCode int, duration time.Duration) {
+	labels := metric.WithAttributes(
+		attribute.String("method", method),
+		attribute.String("route", route),
+		attribute.String("status_code", strconv.Itoa(statusCode)),
+	)
+	m.requestCount.Add(context.Background(), 1, labels)
+	m.requestDuration.Record(context.Background(), duration.Seconds(), labels)
+}
+
+func (m *Meter) RecordUpstream(provider string, duration time.Duration, resp *http.Response, err error) {
+	outcome := "error"
+	if err == nil && resp != nil {
+		outcome = strconv.Itoa(resp.StatusCode)
+	}
+	m.upstreamDuration.Record(context.Background(), duration.Seconds(), metric.WithAttributes(
+		attribute.String("provider", provider),
+		attribute.String("status_code", outcome),
+	))
+}
+
+func (m *Meter) RecordError(category string) {
+	m.errorCount.Add(context.Background(), 1, metric.WithAttributes(attribute.String("category", strings.ReplaceAll(category, " ", "_"))))
+}
+
+func (m *Meter) RecordCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheRequests.Add(context.Background(), 1, metric.WithAttributes(attribute.String("cache", cache), attribute.String("result", result)))
+}
+
+func (m *Meter) RecordCircuitState(upstream, state string) {
+	value := 0.0
+	switch state {
+	case CircuitHalfOpen:
+		value = 1
+	case CircuitOpen:
+		value = 2
+	}
+	m.circuitState.Record(context.Background(), value, metric.WithAttributes(attribute.String("upstream", upstream)))
+}
+
+func (m *Meter) RecordCircuitRejection(upstream string) {
+	m.circuitRejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("upstream", upstream)))
+}
+
+func (m *Meter) RecordBulkheadQueue(upstream string, depth int) {
+	m.bulkheadQueue.Record(context.Background(), float64(depth), metric.WithAttributes(attribute.String("upstream", upstream)))
+}
+
+func (m *Meter) RecordBulkheadRejection(upstream string) {
+	m.bulkheadRejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("upstream", upstream)))
+}
+
+func (m *Meter) Handler() http.Handler {
+	if m.registry == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Prometheus returns the current metrics in the Prometheus text format.
+func (m *Meter) Prometheus() string {
+	if m.registry == nil {
+		return ""
+	}
+	families, err := m.registry.Gather()
+	if err != nil {
+		otel.Handle(err)
+	}
+	var buf bytes.Buffer
+	for _, family := range families {
+		expfmt.MetricFamilyToText(&buf, family)
+	}
+	return buf.String()
+}
+
+type MetricsHandler struct {
+	meter *Meter
+	next  http.Handler
+}
+
+func MetricsMiddleware(meter *Meter, next http.Handler) *MetricsHandler {
+	return &MetricsHandler{meter: meter, next: next}
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := routePattern(h.next, r)
+	if route == "" {
+		route = "unmatched"
+	}
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.next.ServeHTTP(recorder, r)
+	h.meter.RecordRequest(r.Method, route, recorder.status, time.Since(start))
+}
+
+func (h *MetricsHandler) Handler(r *http.Request) (http.Handler, string) {
+	return h, routePattern(h.next, r)
+}
@@ -0,0 +1,196 @@
+package shared
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	meter := NewMeter(nil, "test")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cep", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	handler := TracingMiddleware(tp.Tracer("test"), MetricsMiddleware(meter, mux))
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/cep", nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if name := recorder.Ended()[0].Name(); name != "POST /cep" {
+		t.Errorf("span name = %s, want POST /cep", name)
+	}
+	output := meter.Prometheus()
+	for _, want := range []string{
+		"# TYPE http_server_requests_total counter",
+		`http_server_requests_total{method="POST",route="/cep",status_code="422"} 2`,
+		`http_server_requests_total{method="GET",route="unmatched",status_code="404"} 1`,
+		"# TYPE http_server_request_duration_seconds histogram",
+		`http_server_request_duration_seconds_count{method="POST",route="/cep",status_code="422"} 2`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("metrics output should contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	meter := NewMeter(nil, "test")
+	histogram := meter.NewHistogram("test_duration_seconds", "test", "s", []float64{0.1, 1})
+	for _, value := range []float64{0.05, 0.1, 0.5, 2} {
+		histogram.Record(context.Background(), value, metric.WithAttributes(attribute.String("provider", "viacep")))
+	}
+	output := meter.Prometheus()
+	for _, want := range []string{
+		`test_duration_seconds_bucket{provider="viacep",le="0.1"} 2`,
+		`test_duration_seconds_bucket{provider="viacep",le="1"} 3`,
+		`test_duration_seconds_bucket{provider="viacep",le="+Inf"} 4`,
+		`test_duration_seconds_sum{provider="viacep"} 2.65`,
+		`test_duration_seconds_count{provider="viacep"} 4`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("metrics output should contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestMeterRecordUpstreamAndErrors(t *testing.T) {
+	meter := NewMeter(nil, "test")
+	meter.RecordUpstream("weatherapi", 200*time.Millisecond, &http.Response{StatusCode: http.StatusBadGateway}, nil)
+	meter.RecordUpstream("viacep", time.Second, nil, io.ErrUnexpectedEOF)
+	meter.RecordError("can not find zipcode")
+
+	output := meter.Prometheus()
+	for _, want := range []string{
+		`upstream_request_duration_seconds_count{provider="weatherapi",status_code="502"} 1`,
+		`upstream_request_duration_seconds_count{provider="viacep",status_code="error"} 1`,
+		`errors_total{category="can_not_find_zipcode"} 1`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("metrics output should contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestInitMeterOTLPPush(t *testing.T) {
+	requests := make(chan *colmetricpb.ExportMetricsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			t.Errorf("path = %s, want /v1/metrics", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		request := &colmetricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("payload is not an ExportMetricsServiceRequest: %v", err)
+		}
+		select {
+		case requests <- request:
+		default:
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer server.Close()
+
+	meter, cleanup, err := InitMeter("service-test", Config{
+		MetricsExporters:      []string{"otlphttp"},
+		MetricsExportInterval: time.Hour,
+		OTLPEndpoint:          server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter.RecordError("invalid zipcode")
+	cleanup()
+
+	request := <-requests
+	var serviceName string
+	for _, attr := range request.ResourceMetrics[0].Resource.Attributes {
+		if attr.Key == "service.name" {
+			serviceName = attr.Value.GetStringValue()
+		}
+	}
+	if serviceName != "service-test" {
+		t.Errorf("service.name = %q, want service-test", serviceName)
+	}
+	var found bool
+	for _, scope := range request.ResourceMetrics[0].ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != "errors_total" {
+				continue
+			}
+			point := m.GetSum().GetDataPoints()[0]
+			found = point.GetAsDouble() == 1 && point.Attributes[0].Value.GetStringValue() == "invalid_zipcode"
+		}
+	}
+	if !found {
+		t.Errorf("errors_total{category=invalid_zipcode} 1 not exported: %v", request)
+	}
+	rec := httptest.NewRecorder()
+	meter.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when prometheus exporter is disabled", rec.Code)
+	}
+}
+
+func TestInitMeterCountsExportErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	meter, cleanup, err := InitMeter("service-test", Config{
+		MetricsExporters:      []string{"prometheus", "otlphttp"},
+		MetricsExportInterval: time.Hour,
+		OTLPEndpoint:          server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if err := meter.provider.ForceFlush(context.Background()); err == nil {
+		t.Fatal("ForceFlush() should fail when the collector rejects the export")
+	}
+	if got := metricValue(meter, "errors_total", attribute.String("category", "metrics_export")); got != 1 {
+		t.Errorf("errors_total{category=metrics_export} = %v, want 1", got)
+	}
+}
+
+// metricValue returns the value of the counter or gauge series name{labels}
+// as exposed by the meter's Prometheus registry.
+func metricValue(meter *Meter, name string, labels ...attribute.KeyValue) float64 {
+	families, _ := meter.registry.Gather()
+	want := attribute.NewSet(labels...)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.Metric {
+			var kvs []attribute.KeyValue
+			for _, label := range m.Label {
+				kvs = append(kvs, attribute.String(label.GetName(), label.GetValue()))
+			}
+			if got := attribute.NewSet(kvs...); got.Equals(&want) {
+				if m.Counter != nil {
+					return m.Counter.GetValue()
+				}
+				return m.Gauge.GetValue()
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.status = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func TracingMiddleware(tracer trace.Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routePattern(next, r)
+		spanName := r.Method
+		attrs := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+			semconv.URLScheme(requestScheme(r)),
+			semconv.UserAgentOriginal(r.UserAgent()),
+		}
+		if route != "" {
+			spanName = r.Method + " " + route
+			attrs = append(attrs, semconv.HTTPRoute(route))
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			attrs = append(attrs, semconv.ClientAddress(host))
+		}
+		if cep := requestCEP(r); cep != "" {
+			attrs = append(attrs, AttrCEP.String(cep))
+		}
+		ctx := ExtractTraceContext(r.Context(), r.Header)
+		ctx, span := tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(recorder.status)))
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// maxPeekBody bounds how much of a request body requestCEP reads.
+const maxPeekBody = 4 << 10
+
+// requestCEP returns the CEP of a ZipcodeRequest body, leaving the body
+// intact for the handler. It runs before the server span starts so the
+// sampler can keep a CEP's whole trace from its root.
+func requestCEP(r *http.Request) string {
+	if r.Method != http.MethodPost || r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	peeked, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	var request ZipcodeRequest
+	if json.Unmarshal(peeked, &request) != nil {
+		return ""
+	}
+	return request.CEP
+}
+
+type routeResolver interface {
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+func routePattern(next http.Handler, r *http.Request) string {
+	resolver, ok := next.(routeResolver)
+	if !ok {
+		return r.Pattern
+	}
+	_, pattern := resolver.Handler(r)
+	return pattern
+}
+
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
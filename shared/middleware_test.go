@@ -0,0 +1,69 @@
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/weather", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+	mux.HandleFunc("/cep", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		spanName   string
+		statusCode int
+		wantStatus codes.Code
+	}{
+		{"health", http.MethodGet, "/health", "GET /health", http.StatusOK, codes.Unset},
+		{"client error", http.MethodPost, "/weather", "POST /weather", http.StatusUnprocessableEntity, codes.Unset},
+		{"server error", http.MethodPost, "/cep", "POST /cep", http.StatusInternalServerError, codes.Error},
+		{"unknown route", http.MethodGet, "/missing", "GET", http.StatusNotFound, codes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			handler := TracingMiddleware(tp.Tracer("test"), mux)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.spanName {
+				t.Errorf("span name = %s, want %s", span.Name(), tt.spanName)
+			}
+			if span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("span kind = %s, want %s", span.SpanKind(), trace.SpanKindServer)
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("span status = %s, want %s", span.Status().Code, tt.wantStatus)
+			}
+			attrs := attribute.NewSet(span.Attributes()...)
+			if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != int64(tt.statusCode) {
+				t.Errorf("http.response.status_code = %d, want %d", v.AsInt64(), tt.statusCode)
+			}
+		})
+	}
+}
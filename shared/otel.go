@@ -3,35 +3,43 @@ package shared
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func InitTracer(serviceName, zipkinURL string) (trace.Tracer, func(), error) {
-	exporter, err := zipkin.New(zipkinURL)
+const ServiceVersion = "1.0.0"
+
+func InitTracer(serviceName string, config Config) (trace.Tracer, func(), error) {
+	exporters, err := newSpanExporters(config)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create zipkin exporter: %w", err)
+		return nil, nil, err
 	}
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
+	res, err := NewResource(serviceName)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create resource: %w", err)
+		return nil, nil, err
 	}
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)),
-		sdktrace.WithResource(res),
-	)
+	sampler, err := NewSampler(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res), sdktrace.WithSampler(sampler)}
+	for _, exporter := range exporters {
+		processor := sdktrace.NewBatchSpanProcessor(exporter, sdktrace.WithBatchTimeout(5*time.Second))
+		if config.TraceSampleErrors {
+			processor = newErrorSpanProcessor(processor)
+		}
+		opts = append(opts, sdktrace.WithSpanProcessor(processor))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(NewPropagator())
 	tracer := tp.Tracer(serviceName)
 	cleanup := func() {
 		tp.Shutdown(context.Background())
@@ -39,6 +47,34 @@ func InitTracer(serviceName, zipkinURL string) (trace.Tracer, func(), error) {
 	return tracer, cleanup, nil
 }
 
+func NewResource(serviceName string) (*resource.Resource, error) {
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(ServiceVersion),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
+
 func CreateSpan(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
 	return tracer.Start(ctx, name, opts...)
 }
+
+func NewPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	)
+}
+
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+func ExtractTraceContext(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	otlpProtocolGRPC = "grpc"
+	otlpProtocolHTTP = "http"
+)
+
+type otlpSignal struct {
+	httpPath string
+}
+
+var (
+	otlpTraces  = otlpSignal{httpPath: "/v1/traces"}
+	otlpMetrics = otlpSignal{httpPath: "/v1/metrics"}
+	otlpLogs    = otlpSignal{httpPath: "/v1/logs"}
+)
+
+func otlpProtocol(exporter string) string {
+	if exporter == ExporterOTLPGRPC {
+		return otlpProtocolGRPC
+	}
+	return otlpProtocolHTTP
+}
+
+func otlpBaseURL(endpoint, defaultPort string, insecure bool) (string, error) {
+	if endpoint == "" {
+		endpoint = "localhost:" + defaultPort
+		insecure = true
+	}
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https"
+		if insecure {
+			scheme = "http"
+		}
+		endpoint = scheme + "://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid OTLP endpoint scheme %q", u.Scheme)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// otlpSignalURL resolves where a signal is sent, following the
+// OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT convention: the signal endpoint is
+// used as given, while the generic endpoint (or, when neither is set,
+// localhost on the protocol's default port) gets the signal's HTTP path.
+func otlpSignalURL(protocol string, signal otlpSignal, endpoint, signalEndpoint string, insecure bool) (string, error) {
+	defaultPort := "4318"
+	if protocol == otlpProtocolGRPC {
+		defaultPort = "4317"
+	}
+	if signalEndpoint != "" {
+		endpoint = signalEndpoint
+	}
+	baseURL, err := otlpBaseURL(endpoint, defaultPort, insecure)
+	if err != nil {
+		return "", err
+	}
+	if protocol == otlpProtocolGRPC {
+		return baseURL, nil
+	}
+	if signalEndpoint != "" {
+		if u, _ := url.Parse(baseURL); u.Path != "" {
+			return baseURL, nil
+		}
+	}
+	return baseURL + signal.httpPath, nil
+}
@@ -0,0 +1,179 @@
+package shared
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// newOTLPLogExporter returns the OpenTelemetry OTLP log exporter for
+// protocol, pointed at the logs endpoint resolved from config.
+func newOTLPLogExporter(protocol string, config Config) (sdklog.Exporter, error) {
+	endpoint, err := otlpSignalURL(protocol, otlpLogs, config.OTLPEndpoint, config.OTLPLogsEndpoint, config.OTLPInsecure)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == otlpProtocolGRPC {
+		return otlploggrpc.New(context.Background(),
+			otlploggrpc.WithEndpointURL(endpoint),
+			otlploggrpc.WithHeaders(config.OTLPHeaders),
+		)
+	}
+	return otlploghttp.New(context.Background(),
+		otlploghttp.WithEndpointURL(endpoint),
+		otlploghttp.WithHeaders(config.OTLPHeaders),
+	)
+}
+
+func severity(level slog.Level) otellog.Severity {
+	switch {
+	case level >= slog.LevelError:
+		return otellog.SeverityError
+	case level >= slog.LevelWarn:
+		return otellog.SeverityWarn
+	case level >= slog.LevelInfo:
+		return otellog.SeverityInfo
+	default:
+		return otellog.SeverityDebug
+	}
+}
+
+func severityText(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARN"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// otlpLogHandler bridges slog records to an OpenTelemetry logger, which
+// takes the trace context from the record's ctx.
+type otlpLogHandler struct {
+	logger otellog.Logger
+	attrs  []otellog.KeyValue
+	prefix string
+}
+
+func (h *otlpLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (h *otlpLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	var r otellog.Record
+	r.SetTimestamp(record.Time)
+	r.SetObservedTimestamp(time.Now())
+	r.SetSeverity(severity(record.Level))
+	r.SetSeverityText(severityText(record.Level))
+	r.SetBody(otellog.StringValue(record.Message))
+	r.AddAttributes(h.attrs...)
+	var attrs []otellog.KeyValue
+	record.Attrs(func(attr slog.Attr) bool {
+		switch attr.Key {
+		case "trace_id", "span_id", "trace_flags":
+			return true
+		}
+		attrs = appendSlogAttr(attrs, h.prefix, attr)
+		return true
+	})
+	r.AddAttributes(attrs...)
+	h.logger.Emit(ctx, r)
+	return nil
+}
+
+func (h *otlpLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]otellog.KeyValue(nil), h.attrs...)
+	for _, attr := range attrs {
+		clone.attrs = appendSlogAttr(clone.attrs, h.prefix, attr)
+	}
+	return &clone
+}
+
+func (h *otlpLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func appendSlogAttr(attrs []otellog.KeyValue, prefix string, attr slog.Attr) []otellog.KeyValue {
+	value := attr.Value.Resolve()
+	key := prefix + attr.Key
+	switch value.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix = key + "."
+		}
+		for _, child := range value.Group() {
+			attrs = appendSlogAttr(attrs, groupPrefix, child)
+		}
+		return attrs
+	case slog.KindString:
+		return append(attrs, otellog.String(key, value.String()))
+	case slog.KindInt64:
+		return append(attrs, otellog.Int64(key, value.Int64()))
+	case slog.KindUint64:
+		return append(attrs, otellog.Int64(key, int64(value.Uint64())))
+	case slog.KindFloat64:
+		return append(attrs, otellog.Float64(key, value.Float64()))
+	case slog.KindBool:
+		return append(attrs, otellog.Bool(key, value.Bool()))
+	default:
+		return append(attrs, otellog.String(key, value.String()))
+	}
+}
+
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, handler := range h.handlers {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return &fanoutHandler{handlers: handlers}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &fanoutHandler{handlers: handlers}
+}
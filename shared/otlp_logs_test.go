@@ -0,0 +1,211 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestInitLoggerOTLPExport(t *testing.T) {
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			t.Errorf("path = %s, want /v1/logs", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		request := &collogspb.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("payload is not an ExportLogsServiceRequest: %v", err)
+		}
+		requests <- request
+	}))
+	defer server.Close()
+
+	logger, cleanup, err := InitLogger("service-test", Config{
+		LogLevel:     "INFO",
+		LogExporters: []string{"otlphttp"},
+		OTLPEndpoint: server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+	logger.DebugCtx(ctx, "ignorado", nil)
+	logger.WarnCtx(ctx, "CEP inválido", map[string]interface{}{"cep": "12345"})
+	span.End()
+	cleanup()
+
+	assertExportedLogs(t, <-requests, span.SpanContext().TraceID())
+}
+
+func TestInitLoggerOTLPLogsEndpoint(t *testing.T) {
+	paths := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer server.Close()
+
+	logger, cleanup, err := InitLogger("service-test", Config{
+		LogLevel:         "INFO",
+		LogExporters:     []string{"otlphttp"},
+		OTLPEndpoint:     "http://127.0.0.1:1",
+		OTLPLogsEndpoint: server.URL + "/otlp/logs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("Serviço iniciado", nil)
+	cleanup()
+
+	select {
+	case path := <-paths:
+		if path != "/otlp/logs" {
+			t.Errorf("path = %s, want the logs endpoint as given", path)
+		}
+	default:
+		t.Fatal("logs should be sent to OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	}
+}
+
+func TestLoggerFatalFlushesOTLPLogs(t *testing.T) {
+	if endpoint := os.Getenv("TEST_FATAL_OTLP_ENDPOINT"); endpoint != "" {
+		logger, _, err := InitLogger("service-test", Config{
+			LogLevel:     "INFO",
+			LogExporters: []string{"otlphttp"},
+			OTLPEndpoint: endpoint,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Component("startup").Fatal("Falha ao iniciar", nil)
+		return
+	}
+
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request := &collogspb.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("payload is not an ExportLogsServiceRequest: %v", err)
+		}
+		requests <- request
+	}))
+	defer server.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLoggerFatalFlushesOTLPLogs$")
+	cmd.Env = append(os.Environ(), "TEST_FATAL_OTLP_ENDPOINT="+server.URL)
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("process error = %v, want exit status 1", err)
+	}
+	select {
+	case request := <-requests:
+		record := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+		if record.Body.GetStringValue() != "Falha ao iniciar" {
+			t.Errorf("body = %q, want the fatal message", record.Body.GetStringValue())
+		}
+	default:
+		t.Fatal("Fatal should export buffered logs before exiting")
+	}
+}
+
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	requests chan *collogspb.ExportLogsServiceRequest
+}
+
+func (s *logsService) Export(ctx context.Context, request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.requests <- request
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestInitLoggerOTLPGRPCExport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &logsService{requests: make(chan *collogspb.ExportLogsServiceRequest, 1)}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, service)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	logger, cleanup, err := InitLogger("service-test", Config{
+		LogLevel:     "INFO",
+		LogExporters: []string{"otlpgrpc"},
+		OTLPEndpoint: listener.Addr().String(),
+		OTLPInsecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+	logger.WarnCtx(ctx, "CEP inválido", map[string]interface{}{"cep": "12345"})
+	span.End()
+	cleanup()
+
+	assertExportedLogs(t, <-service.requests, span.SpanContext().TraceID())
+}
+
+// assertExportedLogs checks that request, decoded with the OTLP protobuf
+// types, holds only the WARN record with its attributes and trace context.
+func assertExportedLogs(t *testing.T, request *collogspb.ExportLogsServiceRequest, traceID [16]byte) {
+	t.Helper()
+	if len(request.ResourceLogs) != 1 || len(request.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("request = %v, want one resource and scope", request)
+	}
+	resourceLogs := request.ResourceLogs[0]
+	serviceName := ""
+	for _, attr := range resourceLogs.Resource.Attributes {
+		if attr.Key == "service.name" {
+			serviceName = attr.Value.GetStringValue()
+		}
+	}
+	if serviceName != "service-test" {
+		t.Errorf("service.name = %q, want service-test", serviceName)
+	}
+	records := resourceLogs.ScopeLogs[0].LogRecords
+	if len(records) != 1 {
+		t.Fatalf("records = %d, want only the entry at or above the configured level", len(records))
+	}
+	record := records[0]
+	if record.Body.GetStringValue() != "CEP inválido" || record.SeverityText != "WARN" || record.SeverityNumber != 13 {
+		t.Errorf("record = %q %s %d", record.Body.GetStringValue(), record.SeverityText, record.SeverityNumber)
+	}
+	attributes := map[string]string{}
+	for _, attr := range record.Attributes {
+		attributes[attr.Key] = attr.Value.GetStringValue()
+	}
+	if attributes["cep"] != "12345" {
+		t.Errorf("attributes = %v, want cep=12345", attributes)
+	}
+	if _, ok := attributes["trace_id"]; ok {
+		t.Error("trace correlation should use the log record fields, not attributes")
+	}
+	if !bytes.Equal(record.TraceId, traceID[:]) || len(record.SpanId) != 8 {
+		t.Errorf("trace id = %x, span id = %x, want %x", record.TraceId, record.SpanId, traceID)
+	}
+	if record.TimeUnixNano == 0 || record.ObservedTimeUnixNano == 0 {
+		t.Error("record timestamps should be set")
+	}
+}
+
+func TestInitLoggerUnknownExporter(t *testing.T) {
+	if _, _, err := InitLogger("service-test", Config{LogExporters: []string{"loki"}}); err == nil {
+		t.Error("InitLogger() should fail for unknown exporters")
+	}
+}
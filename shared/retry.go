@@ -0,0 +1,150 @@
+package shared
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy describes how calls to one upstream are retried. An attempt
+// is retried when it fails with a network error or one of RetryableStatus;
+// the wait between attempts grows exponentially from InitialBackoff up to
+// MaxBackoff, minus a random fraction Jitter of it, unless the upstream
+// asks for a specific wait with Retry-After. Timeout bounds all attempts
+// and waits together.
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	Jitter          float64
+	RetryableStatus []int
+	Timeout         time.Duration
+}
+
+const retryBackoffMultiplier = 2
+
+type resendCountKey struct{}
+
+// Backoff returns the wait before the retry following attempt (1-based),
+// without jitter.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= retryBackoffMultiplier
+	}
+	return min(backoff, p.MaxBackoff)
+}
+
+func (p RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return slices.Contains(p.RetryableStatus, resp.StatusCode)
+}
+
+func (p RetryPolicy) wait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+	backoff := p.Backoff(attempt)
+	if p.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * min(p.Jitter, 1) * float64(backoff))
+	}
+	return backoff
+}
+
+// RetryTransport retries requests according to a RetryPolicy. It should
+// wrap a TracingTransport so every attempt gets its own client span; retries
+// are marked on those spans with http.request.resend_count.
+type RetryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func NewRetryTransport(base http.RoundTripper, policy RetryPolicy) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RetryTransport{base: base, policy: policy}
+}
+
+// NewRetryingHTTPClient returns a traced client that retries according to
+// policy, using policy.Timeout as the client timeout for all attempts.
+func NewRetryingHTTPClient(tracer trace.Tracer, policy RetryPolicy) *http.Client {
+	return &http.Client{
+		Transport: NewRetryTransport(NewTracingTransport(http.DefaultTransport, tracer), policy),
+		Timeout:   policy.Timeout,
+	}
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	deadline, hasDeadline := ctx.Deadline()
+	if t.policy.Timeout > 0 {
+		if policyDeadline := time.Now().Add(t.policy.Timeout); !hasDeadline || policyDeadline.Before(deadline) {
+			deadline, hasDeadline = policyDeadline, true
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 {
+			attemptReq = req.Clone(context.WithValue(ctx, resendCountKey{}, attempt-1))
+			if req.Body != nil && req.Body != http.NoBody {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= t.policy.MaxAttempts || !t.policy.retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+		wait := t.policy.wait(attempt, resp)
+		if hasDeadline && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// resendCount returns how many times the request in ctx was sent before.
+func resendCount(ctx context.Context) int {
+	count, _ := ctx.Value(resendCountKey{}).(int)
+	return count
+}
+
+// parseRetryAfter accepts both forms of the Retry-After header: a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+package shared
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      5 * time.Millisecond,
+		Jitter:          0.5,
+		RetryableStatus: []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+		Timeout:         time.Second,
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"cep":"29902555"}` {
+			t.Errorf("attempt %d body = %q", calls.Load()+1, body)
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	recorder := tracetest.NewSpanRecorder()
+	client := NewRetryingHTTPClient(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"), testRetryPolicy())
+
+	resp, err := client.Post(server.URL, "application/json", bytes.NewBufferString(`{"cep":"29902555"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("status = %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want one per attempt", len(spans))
+	}
+	for i, span := range spans {
+		resendCount := -1
+		for _, attr := range span.Attributes() {
+			if attr.Key == semconv.HTTPRequestResendCountKey {
+				resendCount = int(attr.Value.AsInt64())
+			}
+		}
+		if i == 0 && resendCount != -1 || i > 0 && resendCount != i {
+			t.Errorf("span %d resend count = %d", i, resendCount)
+		}
+	}
+}
+
+func TestRetryTransportStopsRetrying(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		timeout    time.Duration
+		wantCalls  int32
+	}{
+		{"not retryable", http.StatusNotFound, "", time.Second, 1},
+		{"max attempts", http.StatusServiceUnavailable, "", time.Second, 3},
+		{"retry after beyond deadline", http.StatusServiceUnavailable, "5", time.Second, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			policy := testRetryPolicy()
+			policy.Timeout = tt.timeout
+			client := &http.Client{Transport: NewRetryTransport(nil, policy)}
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status || calls.Load() != tt.wantCalls {
+				t.Errorf("status = %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), tt.status, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 10: time.Second} {
+		if got := policy.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	policy.Jitter = 0.5
+	for range 20 {
+		if wait := policy.wait(2, nil); wait < 100*time.Millisecond || wait > 200*time.Millisecond {
+			t.Errorf("wait with jitter = %s, want within [100ms, 200ms]", wait)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	if wait := policy.wait(1, resp); wait != 3*time.Second {
+		t.Errorf("wait with Retry-After = %s, want 3s", wait)
+	}
+	if _, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); !ok {
+		t.Error("Retry-After HTTP date should be accepted")
+	}
+}
+
+func TestConfigRetryPolicies(t *testing.T) {
+	t.Setenv("RETRY_MAX_ATTEMPTS", "4")
+	t.Setenv("WEATHERAPI_RETRY_MAX_ATTEMPTS", "2")
+	t.Setenv("SERVICE_B_RETRY_STATUS_CODES", "502, 504")
+	config := GetConfig()
+
+	if policy := config.RetryPolicyFor("viacep"); policy.MaxAttempts != 4 || len(policy.RetryableStatus) != 4 {
+		t.Errorf("viacep policy = %+v, want defaults with 4 attempts", policy)
+	}
+	if policy := config.RetryPolicyFor("weatherapi"); policy.MaxAttempts != 2 {
+		t.Errorf("weatherapi attempts = %d, want 2", policy.MaxAttempts)
+	}
+	if policy := config.RetryPolicyFor("service-b"); len(policy.RetryableStatus) != 2 || policy.RetryableStatus[1] != 504 {
+		t.Errorf("service-b status codes = %v, want [502 504]", policy.RetryableStatus)
+	}
+	if policy := config.RetryPolicyFor("unknown"); policy.MaxAttempts != 4 {
+		t.Errorf("unknown upstream attempts = %d, want default 4", policy.MaxAttempts)
+	}
+}
+
+func TestConfigServiceBRetryStatus(t *testing.T) {
+	t.Setenv("RETRY_STATUS_CODES", "429,502,503,504")
+	config := GetConfig()
+
+	if got := config.RetryPolicyFor("service-b").RetryableStatus; slices.Contains(got, http.StatusServiceUnavailable) || len(got) != 3 {
+		t.Errorf("service-b status codes = %v, want the defaults without 503", got)
+	}
+	if got := config.RetryPolicyFor("viacep").RetryableStatus; !slices.Contains(got, http.StatusServiceUnavailable) {
+		t.Errorf("viacep status codes = %v, want 503 to stay retryable", got)
+	}
+}
@@ -0,0 +1,179 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const AttrCEP = attribute.Key("cep")
+
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+)
+
+func NewSampler(config Config) (sdktrace.Sampler, error) {
+	if config.TraceSamplerArg < 0 || config.TraceSamplerArg > 1 {
+		return nil, fmt.Errorf("invalid sampler ratio %v: must be between 0 and 1", config.TraceSamplerArg)
+	}
+	var sampler sdktrace.Sampler
+	switch strings.ToLower(config.TraceSampler) {
+	case SamplerAlwaysOn:
+		sampler = sdktrace.AlwaysSample()
+	case SamplerAlwaysOff:
+		sampler = sdktrace.NeverSample()
+	case SamplerTraceIDRatio:
+		sampler = sdktrace.TraceIDRatioBased(config.TraceSamplerArg)
+	case SamplerParentBasedAlwaysOn, "":
+		sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	case SamplerParentBasedAlwaysOff:
+		sampler = sdktrace.ParentBased(sdktrace.NeverSample())
+	case SamplerParentBasedTraceIDRatio:
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TraceSamplerArg))
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", config.TraceSampler)
+	}
+	if config.TraceSampleErrors || len(config.TraceSampleCEPPrefixes) > 0 {
+		sampler = &ruleSampler{
+			base:        sampler,
+			cepPrefixes: config.TraceSampleCEPPrefixes,
+			keepErrors:  config.TraceSampleErrors,
+		}
+	}
+	return sampler, nil
+}
+
+type ruleSampler struct {
+	base        sdktrace.Sampler
+	cepPrefixes []string
+	keepErrors  bool
+}
+
+// ShouldSample keeps spans whose CEP matches a prefix, and every span below
+// a sampled local parent so a trace kept by a rule is exported whole. When
+// errors are kept, dropped spans are still recorded for errorSpanProcessor.
+func (s *ruleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() && !parent.IsRemote() && parent.IsSampled() {
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: parent.TraceState()}
+	}
+	for _, attr := range p.Attributes {
+		if attr.Key == AttrCEP && s.matchesCEP(attr.Value.AsString()) {
+			return sdktrace.SamplingResult{
+				Decision:   sdktrace.RecordAndSample,
+				Attributes: []attribute.KeyValue{attribute.String("sampling.rule", "cep_prefix")},
+				Tracestate: parent.TraceState(),
+			}
+		}
+	}
+	result := s.base.ShouldSample(p)
+	if s.keepErrors && result.Decision == sdktrace.Drop {
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+func (s *ruleSampler) matchesCEP(cep string) bool {
+	for _, prefix := range s.cepPrefixes {
+		if strings.HasPrefix(cep, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ruleSampler) Description() string {
+	return fmt.Sprintf("RuleSampler{base:%s,cepPrefixes:%v,keepErrors:%t}", s.base.Description(), s.cepPrefixes, s.keepErrors)
+}
+
+const (
+	maxPendingTraces = 4096
+	maxPendingSpans  = 512
+)
+
+// errorSpanProcessor exports unsampled traces that had an error. Their
+// spans are held until the trace's local root ends: if any of them failed
+// the whole local trace is exported, otherwise it is dropped. Spans ending
+// after their root, or beyond the pending limits, are exported only when
+// they failed themselves.
+type errorSpanProcessor struct {
+	sdktrace.SpanProcessor
+	mu      sync.Mutex
+	pending map[trace.TraceID]*pendingTrace
+}
+
+type pendingTrace struct {
+	root   trace.SpanID
+	spans  []sdktrace.ReadOnlySpan
+	failed bool
+}
+
+func newErrorSpanProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &errorSpanProcessor{SpanProcessor: next, pending: map[trace.TraceID]*pendingTrace{}}
+}
+
+func (p *errorSpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	sc := s.SpanContext()
+	if !sc.IsSampled() && (!s.Parent().IsValid() || s.Parent().IsRemote()) {
+		p.mu.Lock()
+		if _, ok := p.pending[sc.TraceID()]; !ok && len(p.pending) < maxPendingTraces {
+			p.pending[sc.TraceID()] = &pendingTrace{root: sc.SpanID()}
+		}
+		p.mu.Unlock()
+	}
+	p.SpanProcessor.OnStart(parent, s)
+}
+
+func (p *errorSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	sc := s.SpanContext()
+	if sc.IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+	failed := s.Status().Code == codes.Error
+	p.mu.Lock()
+	pending, ok := p.pending[sc.TraceID()]
+	if ok {
+		pending.failed = pending.failed || failed
+	}
+	if !ok || sc.SpanID() != pending.root && len(pending.spans) >= maxPendingSpans {
+		p.mu.Unlock()
+		if failed {
+			p.SpanProcessor.OnEnd(sampledSpan{ReadOnlySpan: s})
+		}
+		return
+	}
+	pending.spans = append(pending.spans, s)
+	if sc.SpanID() != pending.root {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.pending, sc.TraceID())
+	p.mu.Unlock()
+	if !pending.failed {
+		return
+	}
+	for _, span := range pending.spans {
+		p.SpanProcessor.OnEnd(sampledSpan{ReadOnlySpan: span})
+	}
+}
+
+type sampledSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
@@ -0,0 +1,175 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name     string
+		sampler  string
+		arg      float64
+		expected string
+		wantErr  bool
+	}{
+		{"always on", "always_on", 1, "AlwaysOnSampler", false},
+		{"always off", "always_off", 1, "AlwaysOffSampler", false},
+		{"ratio", "traceidratio", 0.25, "TraceIDRatioBased{0.25}", false},
+		{"parent based ratio", "parentbased_traceidratio", 0.5, "ParentBased{root:TraceIDRatioBased{0.5},remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}", false},
+		{"invalid ratio", "traceidratio", 2, "", true},
+		{"unknown", "sometimes", 1, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler, err := NewSampler(Config{TraceSampler: tt.sampler, TraceSamplerArg: tt.arg})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSampler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && sampler.Description() != tt.expected {
+				t.Errorf("sampler = %s, want %s", sampler.Description(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuleSampler(t *testing.T) {
+	config := Config{
+		TraceSampler:           SamplerAlwaysOff,
+		TraceSampleErrors:      true,
+		TraceSampleCEPPrefixes: []string{"299"},
+	}
+	sampler, err := NewSampler(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(newErrorSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))),
+	)
+	tracer := tp.Tracer("test")
+	ctx := context.Background()
+
+	_, dropped := tracer.Start(ctx, "dropped", trace.WithAttributes(AttrCEP.String("01001000")))
+	dropped.End()
+	_, kept := tracer.Start(ctx, "cep prefix", trace.WithAttributes(AttrCEP.String("29902555")))
+	kept.End()
+	_, failed := tracer.Start(ctx, "error")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+		if !span.SpanContext.IsSampled() {
+			t.Errorf("exported span %s should be marked sampled", span.Name)
+		}
+	}
+	if len(names) != 2 || names[0] != "cep prefix" || names[1] != "error" {
+		t.Errorf("exported spans = %v, want [cep prefix error]", names)
+	}
+}
+
+func TestRuleSamplerCEPAtRoot(t *testing.T) {
+	sampler, err := NewSampler(Config{TraceSampler: SamplerAlwaysOff, TraceSampleErrors: true, TraceSampleCEPPrefixes: []string{"299"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(newErrorSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))),
+	)
+	tracer := tp.Tracer("test")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cep", func(w http.ResponseWriter, r *http.Request) {
+		var request ZipcodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CEP == "" {
+			t.Errorf("handler body = %+v, %v, want the original request", request, err)
+		}
+		_, child := tracer.Start(r.Context(), "child")
+		child.End()
+	})
+	handler := TracingMiddleware(tracer, mux)
+
+	for _, cep := range []string{"01001000", "29902555"} {
+		req := httptest.NewRequest(http.MethodPost, "/cep", strings.NewReader(`{"cep":"`+cep+`"}`))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	root, ok := spans["POST /cep"]
+	if !ok || len(spans) != 2 {
+		t.Fatalf("exported spans = %v, want the matching request's root and child", spans)
+	}
+	if child := spans["child"]; child.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("child parent = %s, want the root %s", child.Parent.SpanID(), root.SpanContext.SpanID())
+	}
+	for _, attr := range root.Attributes {
+		if attr.Key == AttrCEP && attr.Value.AsString() != "29902555" {
+			t.Errorf("root cep = %s, want 29902555", attr.Value.AsString())
+		}
+	}
+}
+
+func TestErrorSpanProcessorExportsLocalTrace(t *testing.T) {
+	sampler, err := NewSampler(Config{TraceSampler: SamplerParentBasedAlwaysOff, TraceSampleErrors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(newErrorSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))),
+	)
+	tracer := tp.Tracer("test")
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	})
+
+	ctx, ok := tracer.Start(context.Background(), "ok root")
+	_, okChild := tracer.Start(ctx, "ok child")
+	okChild.End()
+	ok.End()
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("exported %d spans of a trace without errors", len(spans))
+	}
+
+	ctx, root := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), remote), "root")
+	_, failed := tracer.Start(ctx, "failed child")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+	_, sibling := tracer.Start(ctx, "sibling")
+	sibling.End()
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("exported %d spans before the local root ended", len(spans))
+	}
+	root.End()
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+		if !span.SpanContext.IsSampled() || span.SpanContext.TraceID() != remote.TraceID() {
+			t.Errorf("exported span %s = %v, want sampled in the remote trace", span.Name, span.SpanContext)
+		}
+	}
+	if strings.Join(names, ",") != "failed child,sibling,root" {
+		t.Errorf("exported spans = %v, want the whole local trace", names)
+	}
+}
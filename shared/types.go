@@ -1,5 +1,7 @@
 package shared
 
+import "time"
+
 type ZipcodeRequest struct {
 	CEP string `json:"cep"`
 }
@@ -9,6 +11,16 @@ type WeatherResponse struct {
 	TempC float64 `json:"temp_C"`
 	TempF float64 `json:"temp_F"`
 	TempK float64 `json:"temp_K"`
+
+	TempSpreadC      *float64 `json:"temp_spread_C,omitempty"`
+	ObservationAge   *int64   `json:"observation_age_seconds,omitempty"`
+	State            string   `json:"state,omitempty"`
+	IBGE             string   `json:"ibge,omitempty"`
+	Timezone         string   `json:"timezone,omitempty"`
+	Latitude         *float64 `json:"lat,omitempty"`
+	Longitude        *float64 `json:"lon,omitempty"`
+	LocationProvider string   `json:"location_provider,omitempty"`
+	WeatherProvider  string   `json:"weather_provider,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -29,6 +41,43 @@ type ViaCEPResponse struct {
 	Erro        bool   `json:"erro"`
 }
 
+type BrasilAPIResponse struct {
+	CEP          string `json:"cep"`
+	State        string `json:"state"`
+	City         string `json:"city"`
+	Neighborhood string `json:"neighborhood"`
+	Street       string `json:"street"`
+	Service      string `json:"service"`
+	Location     struct {
+		Type        string `json:"type"`
+		Coordinates struct {
+			Longitude string `json:"longitude"`
+			Latitude  string `json:"latitude"`
+		} `json:"coordinates"`
+	} `json:"location"`
+}
+
+type OpenCEPResponse struct {
+	CEP         string `json:"cep"`
+	Logradouro  string `json:"logradouro"`
+	Complemento string `json:"complemento"`
+	Bairro      string `json:"bairro"`
+	Localidade  string `json:"localidade"`
+	UF          string `json:"uf"`
+	IBGE        string `json:"ibge"`
+}
+
+type PostmonResponse struct {
+	CEP        string `json:"cep"`
+	Logradouro string `json:"logradouro"`
+	Bairro     string `json:"bairro"`
+	Cidade     string `json:"cidade"`
+	Estado     string `json:"estado"`
+	CidadeInfo struct {
+		CodigoIBGE string `json:"codigo_ibge"`
+	} `json:"cidade_info"`
+}
+
 type WeatherAPIResponse struct {
 	Location struct {
 		Name    string  `json:"name"`
@@ -38,7 +87,51 @@ type WeatherAPIResponse struct {
 		Lon     float64 `json:"lon"`
 	} `json:"location"`
 	Current struct {
-		TempC float64 `json:"temp_c"`
-		TempF float64 `json:"temp_f"`
+		LastUpdatedEpoch int64   `json:"last_updated_epoch"`
+		TempC            float64 `json:"temp_c"`
+		TempF            float64 `json:"temp_f"`
+		Humidity         float64 `json:"humidity"`
+		WindKPH          float64 `json:"wind_kph"`
 	} `json:"current"`
 }
+
+type OpenMeteoResponse struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Current   struct {
+		Time             int64   `json:"time"`
+		Temperature      float64 `json:"temperature_2m"`
+		RelativeHumidity float64 `json:"relative_humidity_2m"`
+		WindSpeed        float64 `json:"wind_speed_10m"`
+	} `json:"current"`
+}
+
+type WeatherConditions struct {
+	TempC      float64   `json:"temp_C"`
+	SpreadC    *float64  `json:"spread_C,omitempty"`
+	Humidity   float64   `json:"humidity"`
+	WindKPH    float64   `json:"wind_kph"`
+	ObservedAt time.Time `json:"observed_at"`
+	Provider   string    `json:"provider"`
+}
+
+func (c WeatherConditions) TempF() float64 {
+	return c.TempC*1.8 + 32
+}
+
+func (c WeatherConditions) TempK() float64 {
+	return c.TempC + 273.15
+}
+
+type Location struct {
+	CEP          string   `json:"cep"`
+	City         string   `json:"city"`
+	State        string   `json:"state"`
+	IBGE         string   `json:"ibge,omitempty"`
+	Neighborhood string   `json:"neighborhood,omitempty"`
+	Street       string   `json:"street,omitempty"`
+	Timezone     string   `json:"timezone,omitempty"`
+	Provider     string   `json:"provider,omitempty"`
+	Latitude     *float64 `json:"lat,omitempty"`
+	Longitude    *float64 `json:"lon,omitempty"`
+}
@@ -2,6 +2,7 @@ package shared
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -111,6 +112,55 @@ func TestConfigLoading(t *testing.T) {
 	}
 }
 
+func TestConfigDefaultWeatherProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiKey   string
+		provider string
+		expected []string
+	}{
+		{"no key", "", "", []string{"openmeteo"}},
+		{"with key", "secret", "", []string{"weatherapi"}},
+		{"explicit provider", "secret", "openmeteo,weatherapi", []string{"openmeteo", "weatherapi"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEATHER_API_KEY", tt.apiKey)
+			t.Setenv("WEATHER_PROVIDER", tt.provider)
+			got := GetConfig().WeatherProviders
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("WeatherProviders = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfigLocationHedgePercentile(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+	}{
+		{"", 0.95},
+		{"0.5", 0.5},
+		{"1", 1},
+		{"0", 0.95},
+		{"-0.5", 0.95},
+		{"95", 0.95},
+		{"NaN", 0.95},
+		{"p95", 0.95},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("LOCATION_HEDGE_PERCENTILE", tt.value)
+			if got := GetConfig().LocationHedgePercentile; got != tt.expected {
+				t.Errorf("LocationHedgePercentile = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestLoggerCreation(t *testing.T) {
 	logger := NewLogger(INFO, false)
 	if logger == nil {